@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// gomVersion is set when building a release, with
+// go build -ldflags "-X main.gomVersion=v0.4.0".
+var gomVersion = "devel"
+
+// dependencyLine describes the revision gom resolved gom to in vendor.
+func dependencyLine(gom Gom, vendor string) string {
+	if local, ok := gom.localPath(); ok {
+		return fmt.Sprintf("%s path %s", gom.name, local)
+	}
+	if gom.isRelease() {
+		u, _ := gom.releaseURL()
+		return fmt.Sprintf("%s release %s", gom.name, redact(u))
+	}
+	vcs := gom.vcs(vendor)
+	if vcs == nil {
+		return gom.name + " (not installed)"
+	}
+	revision, err := vcs.Revision(gom.dir(vendor))
+	if err != nil {
+		return fmt.Sprintf("%s %s (unknown revision)", gom.name, vcs.name)
+	}
+	return fmt.Sprintf("%s %s %s", gom.name, vcs.name, revision)
+}
+
+// printVersion prints the versions of gom and Go and the GOPATH the tasks
+// run with, and with -deps the revision of each bundle, for bug reports.
+func printVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	deps := fs.Bool("deps", false, "also list the installed revision of each bundle")
+	fs.Parse(args)
+
+	gopath, err := commandGopath()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("gom %s\n", gomVersion)
+	fmt.Printf("go %s %s/%s\n", strings.TrimPrefix(runtime.Version(), "go"), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("GOPATH %s\n", gopath)
+	vendor := filepath.SplitList(gopath)[0]
+	fmt.Printf("vendor %s\n", vendor)
+	if !*deps {
+		return nil
+	}
+
+	goms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	for _, gom := range filterGoms(goms) {
+		fmt.Println(dependencyLine(gom, vendor))
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDependencyLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, second := initGitRepo(t, filepath.Join(dir, "src", "github.com", "mattn", "gom"), "https://github.com/mattn/gom.git")
+
+	for _, c := range []struct {
+		gom      Gom
+		expected string
+	}{
+		{Gom{name: "github.com/mattn/gom", options: map[string]interface{}{}}, "github.com/mattn/gom git " + second},
+		{Gom{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}, "github.com/mattn/go-gtk (not installed)"},
+		{Gom{name: "github.com/mattn/go-local", options: map[string]interface{}{"path": "/src/go-local"}}, "github.com/mattn/go-local path /src/go-local"},
+	} {
+		if line := dependencyLine(c.gom, dir); line != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, line)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var re_tomlTable = regexp.MustCompile(`^\s*\[`)
+var re_tomlKey = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=`)
+var re_tomlName = regexp.MustCompile(`^\s*name\s*=\s*("[^"]*"|'[^']*')`)
+
+// option is a gom option, kept in the order it appears in the Gomfile.
+type option struct {
+	key   string
+	value interface{}
+}
+
+// lineOptions returns the options of a gom line of a Gomfile, in order.
+func lineOptions(line string) []option {
+	opts := make([]option, 0)
+	for _, s := range re_options.FindAllString(line, -1) {
+		m := make(map[string]interface{})
+		parseOptions(s, m)
+		for key, value := range m {
+			opts = append(opts, option{key, value})
+		}
+	}
+	return opts
+}
+
+// replacedKeys returns the options updates replace. Setting any of branch,
+// tag, commit and ref replaces the others.
+func replacedKeys(updates []option) []string {
+	keys := make([]string, 0)
+	for _, u := range updates {
+		keys = append(keys, u.key)
+		if has(versionKeys, u.key) {
+			keys = append(keys, versionKeys...)
+		}
+	}
+	return keys
+}
+
+// formatGomfileOption returns o as it follows the import path on a gom line.
+func formatGomfileOption(o option) string {
+	if a, ok := o.value.([]string); ok && len(a) == 0 {
+		return fmt.Sprintf(", :%s => []", o.key)
+	} else if ok {
+		return fmt.Sprintf(", :%s => [:%s]", o.key, strings.Join(a, ", :"))
+	}
+	return fmt.Sprintf(", :%s => '%v'", o.key, o.value)
+}
+
+func formatGomfileLine(indent, name string, opts []option) string {
+	line := fmt.Sprintf("%sgom '%s'", indent, name)
+	for _, o := range opts {
+		line += formatGomfileOption(o)
+	}
+	return line
+}
+
+// takeUpdate removes from updates, and returns, the first one replacing
+// the option key, if any.
+func takeUpdate(updates []option, key string) ([]option, *option) {
+	for i, u := range updates {
+		if has(replacedKeys([]option{u}), key) {
+			return append(updates[:i:i], updates[i+1:]...), &u
+		}
+	}
+	return updates, nil
+}
+
+// updateGomfileLine returns the gom line with the values of updates. The
+// rest of the line is kept as written, and each update takes the place of
+// the option it replaces, or else goes last, so the diff is no larger than
+// the change.
+func updateGomfileLine(line string, updates []option) string {
+	rest := re_gom.FindStringSubmatch(line)[2]
+	updated := line[:len(line)-len(rest)]
+	drop := replacedKeys(updates)
+	pending := append([]option{}, updates...)
+	for _, text := range re_options.FindAllString(rest, -1) {
+		o := lineOptions(text)[0]
+		if !has(drop, o.key) {
+			updated += text
+			continue
+		}
+		var u *option
+		pending, u = takeUpdate(pending, o.key)
+		if u != nil {
+			updated += formatGomfileOption(*u)
+		}
+	}
+	for _, u := range pending {
+		updated += formatGomfileOption(u)
+	}
+	return updated
+}
+
+func formatTomlValue(v interface{}) string {
+	if a, ok := v.([]string); ok {
+		quoted := make([]string, 0)
+		for _, s := range a {
+			quoted = append(quoted, fmt.Sprintf("%q", s))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(v))
+}
+
+// gomLines returns the indexes of the lines of a Gomfile declaring name.
+func gomLines(lines []string, name string) []int {
+	found := make([]int, 0)
+	for i, line := range lines {
+		if m := re_gom.FindStringSubmatch(line); m != nil && unquote(m[1]) == name {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// tomlComment returns the comment ending the TOML line, with the spaces
+// before it, or "" if it has none.
+func tomlComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[len(strings.TrimRight(line[:i], " \t")):]
+		}
+	}
+	return ""
+}
+
+// tomlTables returns the first and last line indexes of the [[gom]] tables
+// of a Gomfile.toml declaring name.
+func tomlTables(lines []string, name string) [][2]int {
+	found := make([][2]int, 0)
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "[[gom]]" {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) && !re_tomlTable.MatchString(lines[end]) {
+			end++
+		}
+		for _, line := range lines[i+1 : end] {
+			if m := re_tomlName.FindStringSubmatch(line); m != nil && unquote(m[1]) == name {
+				found = append(found, [2]int{i, end - 1})
+				break
+			}
+		}
+		i = end - 1
+	}
+	return found
+}
+
+// appendLines appends added to lines, keeping the final newline of the
+// file last.
+func appendLines(lines []string, added ...string) []string {
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		return append(append(lines, added...), "")
+	}
+	return append(lines, added...)
+}
+
+// addGomfileEntry updates the options of the first line declaring name, or
+// appends one. It returns true if a line was updated.
+func addGomfileEntry(lines []string, name string, opts []option) ([]string, bool) {
+	if found := gomLines(lines, name); len(found) > 0 {
+		lines[found[0]] = updateGomfileLine(lines[found[0]], opts)
+		return lines, true
+	}
+	return appendLines(lines, formatGomfileLine("", name, opts)), false
+}
+
+// addTomlEntry updates the first [[gom]] table declaring name, or appends
+// one. It returns true if a table was updated.
+func addTomlEntry(lines []string, name string, opts []option) ([]string, bool) {
+	table := make([]string, 0)
+	for _, o := range opts {
+		table = append(table, fmt.Sprintf("%s = %s", o.key, formatTomlValue(o.value)))
+	}
+	found := tomlTables(lines, name)
+	if len(found) == 0 {
+		added := append([]string{"[[gom]]", fmt.Sprintf("name = %q", name)}, table...)
+		if len(lines) > 0 && strings.Join(lines, "") != "" {
+			added = append([]string{""}, added...)
+		}
+		return appendLines(lines, added...), false
+	}
+
+	// Like a gom line, each key takes the place of the one it replaces, and
+	// the others follow the name.
+	start, end := found[0][0], found[0][1]
+	drop := replacedKeys(opts)
+	pending := append([]option{}, opts...)
+	for _, line := range lines[start+1 : end+1] {
+		if m := re_tomlKey.FindStringSubmatch(line); m != nil && has(drop, m[1]) {
+			pending, _ = takeUpdate(pending, m[1])
+		}
+	}
+	updated := make([]string, 0, len(lines)+len(opts))
+	updated = append(updated, lines[:start+1]...)
+	for _, line := range lines[start+1 : end+1] {
+		if m := re_tomlKey.FindStringSubmatch(line); m != nil && has(drop, m[1]) {
+			var u *option
+			opts, u = takeUpdate(opts, m[1])
+			if u != nil {
+				updated = append(updated, fmt.Sprintf("%s = %s", u.key, formatTomlValue(u.value))+tomlComment(line))
+			}
+			continue
+		}
+		updated = append(updated, line)
+		if re_tomlName.MatchString(line) {
+			for _, u := range pending {
+				updated = append(updated, fmt.Sprintf("%s = %s", u.key, formatTomlValue(u.value)))
+			}
+		}
+	}
+	updated = append(updated, lines[end+1:]...)
+	return updated, true
+}
+
+// readLines returns the lines of filename, or none if it doesn't exist.
+func readLines(filename string) ([]string, os.FileMode, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, 0644, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	return strings.Split(string(b), "\n"), fi.Mode(), nil
+}
+
+func writeLines(filename string, lines []string, mode os.FileMode) error {
+	content := strings.Join(lines, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return ioutil.WriteFile(filename, []byte(content), mode)
+}
+
+func add(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	tag := fs.String("tag", "", "tag to check out")
+	branch := fs.String("branch", "", "branch to check out")
+	commit := fs.String("commit", "", "commit to check out")
+	group := fs.String("group", "", "comma separated groups of the bundle")
+	// The import path comes first, as in gom add github.com/mattn/gom -tag v1
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		return errors.New("usage: gom add <import path> [-tag X | -branch Y | -commit Z] [-group G]")
+	}
+
+	opts := make([]option, 0)
+	for _, o := range []option{{"branch", *branch}, {"tag", *tag}, {"commit", *commit}} {
+		if o.value != "" {
+			opts = append(opts, o)
+		}
+	}
+	if len(opts) > 1 {
+		return errors.New("give only one of -branch, -tag and -commit")
+	}
+	if *group != "" {
+		opts = append(opts, option{"group", splitGroups(*group)})
+	}
+
+	return setGomfileEntry(name, opts)
+}
+
+// setGomfileEntry adds name with opts to the Gomfile, or sets opts on the
+// entry of name already in it.
+func setGomfileEntry(name string, opts []option) error {
+	filename := gomfilePath()
+	if filename == stdinGomfile {
+		return errors.New("can't edit a Gomfile read from stdin")
+	}
+	lines, mode, err := readLines(filename)
+	if err != nil {
+		return err
+	}
+	updated := false
+	if strings.HasSuffix(filename, ".toml") {
+		lines, updated = addTomlEntry(lines, name, opts)
+	} else {
+		lines, updated = addGomfileEntry(lines, name, opts)
+	}
+	err = writeLines(filename, lines, mode)
+	if err != nil {
+		return err
+	}
+	if updated {
+		fmt.Printf("updated %s in %s\n", name, filename)
+	} else {
+		fmt.Printf("added %s to %s\n", name, filename)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAddGomfileEntry(t *testing.T) {
+	lines := strings.Split(`# tools
+gom 'github.com/mattn/go-runewidth', :tag => 'go1'
+group :test do
+	gom 'github.com/mattn/go-sqlite3', :branch => 'master', :goos => [:linux, :darwin]
+end
+
+# written by hand
+gom "github.com/mattn/go-colorable",  :goos => 'windows'
+`, "\n")
+	lines, updated := addGomfileEntry(lines, "github.com/mattn/go-sqlite3", []option{{"tag", "v1.14.0"}})
+	if !updated {
+		t.Fatal("Expected github.com/mattn/go-sqlite3 to be updated")
+	}
+	lines, updated = addGomfileEntry(lines, "github.com/mattn/go-colorable", []option{{"tag", "v0.1.8"}})
+	if !updated {
+		t.Fatal("Expected github.com/mattn/go-colorable to be updated")
+	}
+	lines, updated = addGomfileEntry(lines, "github.com/mattn/go-ole", []option{{"group", []string{"test", "ci"}}})
+	if updated {
+		t.Fatal("Expected github.com/mattn/go-ole to be added")
+	}
+	expected := strings.Split(`# tools
+gom 'github.com/mattn/go-runewidth', :tag => 'go1'
+group :test do
+	gom 'github.com/mattn/go-sqlite3', :tag => 'v1.14.0', :goos => [:linux, :darwin]
+end
+
+# written by hand
+gom "github.com/mattn/go-colorable",  :goos => 'windows', :tag => 'v0.1.8'
+gom 'github.com/mattn/go-ole', :group => [:test, :ci]
+`, "\n")
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, lines)
+	}
+}
+
+func TestAddTomlEntry(t *testing.T) {
+	for _, c := range []struct {
+		table    string
+		expected string
+	}{
+		{`branch = "master" # for now
+goos = ["linux"]
+`, `commit = "8897bf14" # for now
+goos = ["linux"]
+`},
+		{`goos = ["linux"]
+branch = "master#1"	# "for now"
+`, `goos = ["linux"]
+commit = "8897bf14"	# "for now"
+`},
+	} {
+		lines := strings.Split(`[[gom]]
+name = "github.com/mattn/go-sqlite3"
+`+c.table+`
+[[gom]]
+name = "github.com/mattn/go-runewidth"
+`, "\n")
+		lines, updated := addTomlEntry(lines, "github.com/mattn/go-sqlite3", []option{{"commit", "8897bf14"}})
+		if !updated {
+			t.Fatal("Expected github.com/mattn/go-sqlite3 to be updated")
+		}
+		lines, updated = addTomlEntry(lines, "github.com/mattn/go-ole", []option{{"tag", "v1"}})
+		if updated {
+			t.Fatal("Expected github.com/mattn/go-ole to be added")
+		}
+		expected := strings.Split(`[[gom]]
+name = "github.com/mattn/go-sqlite3"
+`+c.expected+`
+[[gom]]
+name = "github.com/mattn/go-runewidth"
+
+[[gom]]
+name = "github.com/mattn/go-ole"
+tag = "v1"
+`, "\n")
+		if !reflect.DeepEqual(lines, expected) {
+			t.Fatalf("Expected %v, but %v:", expected, lines)
+		}
+	}
+}
+
+func TestReplacedKeys(t *testing.T) {
+	for _, c := range []struct {
+		updates  []option
+		expected []string
+	}{
+		{[]option{{"goos", "linux"}}, []string{"goos"}},
+		{[]option{{"tag", "v1.14.0"}}, []string{"tag", "branch", "tag", "commit", "ref"}},
+		{[]option{{"ref", "refs/pull/1/head"}}, []string{"ref", "branch", "tag", "commit", "ref"}},
+	} {
+		if keys := replacedKeys(c.updates); !reflect.DeepEqual(keys, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, keys)
+		}
+	}
+
+	// A tag takes the place of the ref it pins the gom instead of.
+	line := updateGomfileLine("gom 'github.com/mattn/go-sqlite3', :ref => 'refs/pull/1/head'", []option{{"tag", "v1.14.0"}})
+	if expected := "gom 'github.com/mattn/go-sqlite3', :tag => 'v1.14.0'"; line != expected {
+		t.Fatalf("Expected %v, but %v:", expected, line)
+	}
+}
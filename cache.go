@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cacheDir returns the directory repositories are cached in across
+// projects: the one given with -cache, or $GOM_CACHE, or ~/.gom/cache.
+func cacheDir() string {
+	if *cacheFlag != "" {
+		return *cacheFlag
+	}
+	if dir := os.Getenv("GOM_CACHE"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gom", "cache")
+}
+
+// useCache returns true if repositories should go through the cache.
+func useCache() bool {
+	return !*noCache && !*dryRun && cacheDir() != ""
+}
+
+// cacheable returns true if gom may go through the cache. Private
+// repositories don't, so other projects of the machine can't get them
+// without credentials.
+func (gom *Gom) cacheable() bool {
+	private, _ := gom.options["private"].(string)
+	return useCache() && !boolString[strings.ToLower(private)]
+}
+
+// copyRepo copies the repository src to dest, which mustn't hold anything
+// yet. The copy is made next to dest and renamed into place once complete,
+// so an interrupted copy never looks like a repository.
+func copyRepo(dest, src string) error {
+	parent := filepath.Dir(dest)
+	err := os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(parent, "."+filepath.Base(dest)+".copy")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	err = copyDir(tmp, src)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// restoreFromCache copies the cached repository of name into the vendor
+// directory, unless it is already there, fetching into the cache first if
+// the revision gom is pinned to is missing. It returns true if the
+// repository was restored.
+func (gom *Gom) restoreFromCache(vendor, name string) bool {
+	if !gom.cacheable() {
+		return false
+	}
+	if _, vcs := findRepo(filepath.Join(vendor, "src"), name); vcs != nil {
+		return false
+	}
+	root, vcs := findRepo(filepath.Join(cacheDir(), "src"), name)
+	if vcs == nil {
+		return false
+	}
+
+	if rev := gom.version(); rev != "" && !isVersionConstraint(rev) && !has(gom.options, "ref") {
+		if _, err := vcs.Resolve(root, rev); err != nil {
+			progressf("updating cached %s\n", name)
+			if err := vcs.Update(root); err != nil {
+				warnf("failed to update cached %s: %v\n", name, err)
+				return false
+			}
+		}
+	}
+
+	rel, err := filepath.Rel(filepath.Join(cacheDir(), "src"), root)
+	if err != nil {
+		return false
+	}
+	progressf("copying %s from cache\n", name)
+	if err := copyRepo(filepath.Join(vendor, "src", rel), root); err != nil {
+		warnf("failed to copy cached %s: %v\n", name, err)
+		return false
+	}
+	return true
+}
+
+// saveToCache copies the repository of name from the vendor directory into
+// the cache, unless it is already cached.
+func (gom *Gom) saveToCache(vendor, name string) {
+	if !gom.cacheable() {
+		return
+	}
+	if _, vcs := findRepo(filepath.Join(cacheDir(), "src"), name); vcs != nil {
+		return
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), name)
+	if vcs == nil {
+		return
+	}
+	rel, err := filepath.Rel(filepath.Join(vendor, "src"), root)
+	if err != nil {
+		return
+	}
+	if err := copyRepo(filepath.Join(cacheDir(), "src", rel), root); err != nil {
+		warnf("failed to cache %s: %v\n", name, err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldCache, oldNoCache, oldDryRun := *cacheFlag, *noCache, *dryRun
+	defer func() { *cacheFlag, *noCache, *dryRun = oldCache, oldNoCache, oldDryRun }()
+	*cacheFlag, *noCache, *dryRun = filepath.Join(dir, "cache"), false, false
+
+	vendor := filepath.Join(dir, "vendor")
+	_, second := initGitRepo(t, filepath.Join(vendor, "src", "github.com", "mattn", "gom"), "https://github.com/mattn/gom.git")
+	gom := &Gom{name: "github.com/mattn/gom", options: map[string]interface{}{}}
+	gom.saveToCache(vendor, gom.name)
+	cached := filepath.Join(cacheDir(), "src", "github.com", "mattn", "gom")
+	if rev, err := git.Revision(cached); err != nil || rev != second {
+		t.Fatalf("Expected %v, but %v:", second, rev)
+	}
+	// Nothing of the copy is left next to the cached repository.
+	entries, err := ioutil.ReadDir(filepath.Dir(cached))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected %v, but %v:", 1, len(entries))
+	}
+
+	other := filepath.Join(dir, "other")
+	if !gom.restoreFromCache(other, gom.name) {
+		t.Fatal("Expected github.com/mattn/gom to be restored from the cache")
+	}
+	if rev, err := git.Revision(gom.dir(other)); err != nil || rev != second {
+		t.Fatalf("Expected %v, but %v:", second, rev)
+	}
+
+	// What an interrupted copy leaves next to a repository isn't one.
+	partial, err := ioutil.TempDir(filepath.Dir(cached), ".go-sqlite3.copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(partial, ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite3 := &Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{}}
+	if sqlite3.restoreFromCache(other, sqlite3.name) {
+		t.Fatal("Expected a partial copy not to be restored")
+	}
+
+	// Private repositories aren't cached.
+	private := &Gom{name: "example.com/mattn/private", options: map[string]interface{}{"private": "true"}}
+	initGitRepo(t, private.dir(vendor), "git@example.com:mattn/private.git")
+	private.saveToCache(vendor, private.name)
+	if isDir(filepath.Join(cacheDir(), "src", "example.com")) {
+		t.Fatal("Expected a private repository not to be cached")
+	}
+}
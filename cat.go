@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+func copyOptions(options map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		c[key] = value
+	}
+	return c
+}
+
+// optionSources records where the options in effect for a gom come from,
+// the Gomfile or a step resolving them, and those a step dropped.
+type optionSources struct {
+	from    map[string]string
+	dropped map[string]string
+	values  map[string]interface{}
+}
+
+func newOptionSources(gom *Gom, source string) *optionSources {
+	s := &optionSources{map[string]string{}, map[string]string{}, copyOptions(gom.options)}
+	for key := range gom.options {
+		s.from[key] = source
+	}
+	return s
+}
+
+// step records the options of gom changed, added or removed by source since
+// the last step.
+func (s *optionSources) step(gom *Gom, source string) {
+	for key, value := range gom.options {
+		if old, ok := s.values[key]; !ok || !reflect.DeepEqual(old, value) {
+			s.from[key] = source
+		}
+	}
+	for key, value := range s.values {
+		if _, ok := gom.options[key]; !ok {
+			s.dropped[key] = fmt.Sprintf("%s, overridden by %s", formatOption(value), source)
+			delete(s.from, key)
+		}
+	}
+	s.values = copyOptions(gom.options)
+}
+
+func (s *optionSources) write(w io.Writer, gom *Gom) {
+	keys := make([]string, 0, len(gom.options)+len(s.dropped))
+	for key := range gom.options {
+		keys = append(keys, key)
+	}
+	for key := range s.dropped {
+		if _, ok := gom.options[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(w, gom.name)
+	for _, key := range keys {
+		if value, ok := gom.options[key]; ok {
+			fmt.Fprintf(w, "  %s: %s (%s)\n", key, formatOption(value), s.from[key])
+		} else {
+			fmt.Fprintf(w, "  %s: none (was %s)\n", key, s.dropped[key])
+		}
+	}
+}
+
+// cat prints the options in effect for the gom named in args, once the
+// groups, Gomfile.lock and the host defaults of the Gomfile apply, each with
+// where it comes from, and the revision the gom resolves to if installed.
+func cat(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: gom cat <import path>")
+	}
+	name := normalizeImportPath(args[0])
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	var gom *Gom
+	for i := range allGoms {
+		if allGoms[i].name == name {
+			gom = &allGoms[i]
+		}
+	}
+	if gom == nil {
+		goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+		if err != nil {
+			return err
+		}
+		for _, g := range goms {
+			if g.name == name {
+				return fmt.Errorf("%s is in %s, but not in the groups installed here", name, gomfilePath())
+			}
+		}
+		return fmt.Errorf("%s is not in %s", name, gomfilePath())
+	}
+
+	sources := newOptionSources(gom, gomfilePath())
+	if !*noLock && isFile(lockfilePath()) {
+		locks, err := parseLockfile(lockfilePath())
+		if err != nil {
+			return err
+		}
+		for _, l := range locks {
+			if l.name == gom.name {
+				applyLocks([]Gom{*gom}, []lock{l})
+			}
+		}
+		sources.step(gom, lockfilePath())
+	}
+	h, err := parseSettings(gomfilePath())
+	if err != nil {
+		return err
+	}
+	applySSHHosts([]Gom{*gom}, h.sshHosts())
+	sources.step(gom, "ssh_hosts")
+	defaults, err := h.defaultBranches()
+	if err != nil {
+		return err
+	}
+	err = applyDefaultBranches([]Gom{*gom}, defaults)
+	if err != nil {
+		return err
+	}
+	sources.step(gom, "default_branches")
+
+	sources.write(stdout, gom)
+	if len(filterGoms([]Gom{*gom})) == 0 {
+		fmt.Fprintln(stdout, "not installed here, because of its goos, goarch or group")
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	if vcs == nil {
+		fmt.Fprintln(stdout, "not installed yet")
+		return nil
+	}
+	wanted, version, err := gom.wantedRevision(root, vcs)
+	if err != nil {
+		return err
+	}
+	if wanted != "" {
+		fmt.Fprintf(stdout, "%s resolves to %s\n", version, wanted)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldGomfile, oldVendor := *gomfileFlag, vendorFolder
+	defer func() { *gomfileFlag, vendorFolder = oldGomfile, oldVendor }()
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	vendorFolder = filepath.Join(dir, "_vendor")
+
+	err = ioutil.WriteFile(*gomfileFlag, []byte(`default_branches 'github.com=main'
+gom 'github.com/mattn/go-sqlite3', :tag => 'v1.14.0', :goos => 'plan9'
+gom 'github.com/mattn/go-runewidth'
+group :production do
+  gom 'github.com/mattn/go-colorable'
+end
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(lockfilePath(), []byte("github.com/mattn/go-sqlite3 git 8897bf14\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-sqlite3", `github.com/mattn/go-sqlite3
+  commit: 8897bf14 (` + lockfilePath() + `)
+  goos: plan9 (` + *gomfileFlag + `)
+  tag: none (was v1.14.0, overridden by ` + lockfilePath() + `)
+not installed here, because of its goos, goarch or group
+`},
+		{"github.com/mattn/go-runewidth/", `github.com/mattn/go-runewidth
+  branch: main (default_branches)
+not installed yet
+`},
+	} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldstdout := stdout
+		stdout = w
+		err = cat([]string{c.name})
+		w.Close()
+		stdout = oldstdout
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, string(b))
+		}
+	}
+
+	err = cat([]string{"github.com/mattn/go-colorable"})
+	if err == nil || err.Error() != "github.com/mattn/go-colorable is in "+*gomfileFlag+", but not in the groups installed here" {
+		t.Fatalf("Expected an error for go-colorable, but %v:", err)
+	}
+	err = cat([]string{"github.com/mattn/go-isatty"})
+	if err == nil {
+		t.Fatal("Expected an error for go-isatty, which isn't in Gomfile")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// knownOptions are the options a gom may have in a Gomfile.
+var knownOptions = []string{
+	"branch", "build", "buildflags", "command", "commit", "depth", "fork",
+	"goarch", "goos", "group", "https", "patch", "path", "post_checkout",
+	"private", "proxy", "recursive", "ref", "release", "replace", "sha256",
+	"submodules", "tag", "target", "token_env", "url",
+}
+
+// versionOptions returns which of branch, tag, commit and ref, the options
+// selecting the revision to check out, gom has. Checkout refuses more than
+// one.
+func versionOptions(gom *Gom) []string {
+	keys := make([]string, 0)
+	for _, key := range versionKeys {
+		if _, ok := gom.options[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ignoredVersionOptions returns the option gom is fetched by without being
+// checked out, path, url, release or command, and the version options it has
+// that would be ignored because of it. A release is fetched for its tag, so
+// only branch, commit and ref are ignored there.
+func ignoredVersionOptions(gom *Gom) (string, []string) {
+	source := ""
+	for _, key := range []string{"path", "url", "release", "command"} {
+		if has(gom.options, key) {
+			source = key
+			break
+		}
+	}
+	if source == "" {
+		return "", nil
+	}
+	keys := make([]string, 0)
+	for _, key := range versionOptions(gom) {
+		if source != "release" || key != "tag" {
+			keys = append(keys, key)
+		}
+	}
+	return source, keys
+}
+
+// checkGoms returns the problems found in goms: unknown options, more than
+// one of branch, tag, commit and ref on a gom, or one on a gom that isn't
+// checked out, both release and url, and import paths declared more than
+// once.
+func checkGoms(goms []Gom) []string {
+	problems := make([]string, 0)
+	seen := make(map[string]int)
+	for _, gom := range goms {
+		keys := make([]string, 0, len(gom.options))
+		for key := range gom.options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !has(knownOptions, key) {
+				problems = append(problems, fmt.Sprintf("%s: unknown option %s", gom.name, key))
+			}
+		}
+		if keys := versionOptions(&gom); len(keys) > 1 {
+			problems = append(problems, fmt.Sprintf("%s: conflicting options %s", gom.name, strings.Join(keys, ", ")))
+		}
+		if source, keys := ignoredVersionOptions(&gom); len(keys) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: conflicting options %s, %s", gom.name, strings.Join(keys, ", "), source))
+		}
+		if has(gom.options, "release") && has(gom.options, "url") {
+			problems = append(problems, fmt.Sprintf("%s: conflicting options release, url", gom.name))
+		}
+		seen[gom.name]++
+		if seen[gom.name] == 2 {
+			problems = append(problems, fmt.Sprintf("%s: declared more than once", gom.name))
+		}
+	}
+	return problems
+}
+
+func check() error {
+	filename := gomfilePath()
+	goms, err := parseGomfileGroups(filename, anyGroup)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	problems := checkGoms(goms)
+	for _, problem := range problems {
+		fmt.Printf("%s: %s\n", filename, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in %s", len(problems), filename)
+	}
+	return nil
+}
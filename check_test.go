@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckGoms(t *testing.T) {
+	goms := []Gom{
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"tag": "go1"}},
+		{name: "github.com/mattn/go-scan", options: map[string]interface{}{"branch": "master", "commit": "ecb144fb1f28"}},
+		{name: "github.com/mattn/go-ole", options: map[string]interface{}{"gooss": "windows", "tagg": "v1"}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+	}
+	expected := []string{
+		"github.com/mattn/go-scan: conflicting options branch, commit",
+		"github.com/mattn/go-ole: unknown option gooss",
+		"github.com/mattn/go-ole: unknown option tagg",
+		"github.com/mattn/go-runewidth: declared more than once",
+	}
+	if problems := checkGoms(goms); !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, problems)
+	}
+	if problems := checkGoms(goms[:1]); len(problems) != 0 {
+		t.Fatalf("Expected no problems, but %v:", problems)
+	}
+}
+
+func TestCheckVersionOptions(t *testing.T) {
+	for _, c := range []struct {
+		options  map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{"tag": "v1"}, []string{}},
+		{map[string]interface{}{"command": "fetch.sh {{.Name}}"}, []string{}},
+		{map[string]interface{}{"command": "fetch.sh {{.Name}}", "commit": "ecb144fb1f28"}, []string{"github.com/mattn/foo: conflicting options commit, command"}},
+		{map[string]interface{}{"path": "../foo"}, []string{}},
+		{map[string]interface{}{"path": "../foo", "tag": "v1"}, []string{"github.com/mattn/foo: conflicting options tag, path"}},
+		{map[string]interface{}{"path": "../foo", "branch": "master"}, []string{"github.com/mattn/foo: conflicting options branch, path"}},
+		{map[string]interface{}{"url": "https://example.com/foo.tar.gz"}, []string{}},
+		{map[string]interface{}{"url": "https://example.com/foo.tar.gz", "commit": "ecb144fb1f28"}, []string{"github.com/mattn/foo: conflicting options commit, url"}},
+		{map[string]interface{}{"url": "https://example.com/foo.tar.gz", "ref": "refs/pull/1/head"}, []string{"github.com/mattn/foo: conflicting options ref, url"}},
+		{map[string]interface{}{"release": "https://example.com/foo-{{.Tag}}.tar.gz", "tag": "v1"}, []string{}},
+		{map[string]interface{}{"release": "https://example.com/foo-{{.Tag}}.tar.gz", "branch": "master"}, []string{"github.com/mattn/foo: conflicting options branch, release"}},
+	} {
+		gom := Gom{name: "github.com/mattn/foo", options: c.options}
+		if problems := checkGoms([]Gom{gom}); !reflect.DeepEqual(problems, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, problems)
+		}
+		_, keys := ignoredVersionOptions(&gom)
+		err := gom.Checkout()
+		if len(keys) > 0 && err == nil {
+			t.Fatalf("Expected Checkout of %v to fail", c.options)
+		}
+	}
+}
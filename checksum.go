@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const sumfile = "Gomfile.sum"
+
+// sumfilePath returns the Gomfile.sum of the Gomfile given with -gomfile,
+// its name with .sum appended, like lockfilePath.
+func sumfilePath() string {
+	if *gomfileFlag != "" && *gomfileFlag != stdinGomfile {
+		return *gomfileFlag + ".sum"
+	}
+	return sumfile
+}
+
+// checksum is a single line of Gomfile.sum: the SHA-256 of the tree of a gom
+// checked out at a revision.
+type checksum struct {
+	name     string
+	revision string
+	sum      string
+}
+
+func parseSumfile(filename string) ([]checksum, error) {
+	records, err := readRecords(filename, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]checksum, 0)
+	for _, r := range records {
+		sums = append(sums, checksum{r[0], r[1], r[2]})
+	}
+	return sums, nil
+}
+
+func writeSumfile(filename string, sums []checksum) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	sort.Slice(sums, func(i, j int) bool { return sums[i].name < sums[j].name })
+	fmt.Fprintln(w, "# Generated by gom install. Do not edit.")
+	for _, c := range sums {
+		fmt.Fprintf(w, "%s %s %s\n", c.name, c.revision, c.sum)
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// isVCSMetadata returns true if name is one of the vcsMarkers.
+func isVCSMetadata(name string) bool {
+	for _, m := range vcsMarkers {
+		if m.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hashTree returns the SHA-256 of the paths, types and contents of the files
+// below root, and of whether they are executable, ignoring version control
+// metadata. The other permission bits vary with the umask of the checkout.
+func hashTree(root string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if isVCSMetadata(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %v %t\x00", filepath.ToSlash(rel), info.Mode()&os.ModeType, info.Mode()&0111 != 0)
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			io.WriteString(h, target)
+		} else if info.Mode().IsRegular() {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		io.WriteString(h, "\x00")
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksums hashes the trees of goms and compares them with the ones
+// recorded in Gomfile.sum for the same revision. It returns the checksums
+// to record next, keeping the entries of goms that weren't hashed.
+func verifyChecksums(goms []Gom, vendor string) ([]checksum, error) {
+	recorded := make([]checksum, 0)
+	if isFile(sumfilePath()) {
+		var err error
+		recorded, err = parseSumfile(sumfilePath())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sums := make([]checksum, 0)
+	hashed := make(map[string]bool)
+	for _, gom := range goms {
+		if _, ok := gom.localPath(); ok {
+			// Changes of a local directory are expected.
+			continue
+		}
+		p := gom.dir(vendor)
+		revision := "-"
+		if vcs := gom.vcs(vendor); vcs != nil {
+			if r, err := vcs.Revision(p); err == nil {
+				revision = r
+			}
+		}
+		sum, err := hashTree(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range recorded {
+			if c.name == gom.name && c.revision == revision && c.sum != sum {
+				if !*updateChecksums {
+					return nil, fmt.Errorf("checksum mismatch for %s at %s: %s recorded, but %s (use -update-checksums if this is expected)", gom.name, revision, c.sum, sum)
+				}
+				warnf("updating checksum of %s at %s\n", gom.name, revision)
+			}
+		}
+		sums = append(sums, checksum{gom.name, revision, sum})
+		hashed[gom.name] = true
+	}
+	for _, c := range recorded {
+		if !hashed[c.name] {
+			sums = append(sums, c)
+		}
+	}
+	return sums, nil
+}
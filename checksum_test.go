@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum1, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VCS metadata must not change the sum.
+	err = os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/master\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum2, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum1 != sum2 {
+		t.Fatalf("Expected %v, but %v:", sum1, sum2)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package foo\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum3, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum1 == sum3 {
+		t.Fatal("Expected the sum to change with the contents")
+	}
+}
+
+func TestHashTreeModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "build.sh")
+	err = ioutil.WriteFile(p, []byte("#!/bin/sh\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum1, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another umask must not change the sum.
+	err = os.Chmod(p, 0664)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum2, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum1 != sum2 {
+		t.Fatalf("Expected %v, but %v:", sum1, sum2)
+	}
+
+	err = os.Chmod(p, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum3, err := hashTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum1 == sum3 {
+		t.Fatal("Expected the sum to change with the executable bit")
+	}
+}
+
+func TestWriteSumfileError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	// The write only fails once what was written is flushed.
+	err := writeSumfile("/dev/full", []checksum{{name: "github.com/mattn/go-runewidth", revision: "14e809f6d3f5", sum: "h1"}})
+	if err == nil {
+		t.Fatalf("Expected the full device to fail the write, but nil:")
+	}
+}
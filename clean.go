@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// orphanedRepos returns the vendored repos that are neither in the Gomfile,
+// for any group, nor imported by something that is.
+func orphanedRepos(vendor string) ([]string, error) {
+	goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := vendoredRepos(vendor)
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := referencedRepos(vendor, goms, repos)
+	if err != nil {
+		return nil, err
+	}
+	orphans := make([]string, 0)
+	for _, repo := range repos {
+		if !referenced[repo] {
+			orphans = append(orphans, repo)
+		}
+	}
+	return orphans, nil
+}
+
+func clean(args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	onlyPrint := fs.Bool("dry-run", *dryRun, "only print what would be removed")
+	fs.Parse(args)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	orphans, err := orphanedRepos(vendor)
+	if err != nil {
+		return err
+	}
+	for _, repo := range orphans {
+		if *onlyPrint {
+			fmt.Printf("would remove %s\n", repo)
+			continue
+		}
+		fmt.Printf("removing %s\n", repo)
+		err = os.RemoveAll(filepath.Join(vendor, "src", filepath.FromSlash(repo)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
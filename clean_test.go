@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReferencedRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"src/github.com/mattn/go-gtk/.git/HEAD": "",
+		"src/github.com/mattn/go-gtk/gtk/gtk.go": `package gtk
+
+import "github.com/mattn/go-pointer"
+`,
+		"src/github.com/mattn/go-pointer/.git/HEAD": "",
+		"src/github.com/mattn/go-pointer/pointer_windows.go": `// +build windows
+
+package pointer
+
+import "github.com/mattn/go-ole"
+`,
+		"src/github.com/mattn/go-ole/.git/HEAD":    "",
+		"src/github.com/mattn/go-ole/ole.go":       "package ole\n",
+		"src/github.com/mattn/go-unused/.git/HEAD": "",
+		"src/github.com/mattn/go-unused/unused.go": "package unused\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := vendoredRepos(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms := []Gom{{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}}
+	referenced, err := referencedRepos(dir, goms, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"github.com/mattn/go-gtk":     true,
+		"github.com/mattn/go-pointer": true,
+		"github.com/mattn/go-ole":     true,
+	}
+	if !reflect.DeepEqual(referenced, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, referenced)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configFiles returns the files holding the defaults of the global flags,
+// in the order they apply: $XDG_CONFIG_HOME/gom/config, or
+// ~/.config/gom/config, then .gomrc of the current directory.
+func configFiles() []string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	files := make([]string, 0)
+	if dir != "" {
+		files = append(files, filepath.Join(dir, "gom", "config"))
+	}
+	return append(files, ".gomrc")
+}
+
+// applyConfig sets the flags of fs given in filename, one key=value line
+// each, the key being the name of the flag. Blank lines and lines starting
+// with # are skipped. A missing file sets nothing.
+func applyConfig(fs *flag.FlagSet, filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%s:%d: expected key=value, but %q", filename, n, line)
+		}
+		key := strings.TrimLeft(strings.TrimSpace(kv[0]), "-")
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown flag %s", filename, n, key)
+		}
+		err = fs.Set(key, unquote(strings.TrimSpace(kv[1])))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", filename, n, key, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// loadConfig sets the global flags from the config files, before the
+// command line is parsed, so the flags given there win.
+func loadConfig() error {
+	for _, filename := range configFiles() {
+		err := applyConfig(flag.CommandLine, filename)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
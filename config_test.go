@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestApplyConfig(t *testing.T) {
+	filename, err := tempGomfile(`
+# Team defaults
+vendor = vendor
+retries=5
+timeout = '30m'
+-no-color = true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+
+	fs := flag.NewFlagSet("gom", flag.ContinueOnError)
+	vendor := fs.String("vendor", "", "")
+	retries := fs.Int("retries", 3, "")
+	timeout := fs.Duration("timeout", 10*time.Minute, "")
+	noColor := fs.Bool("no-color", false, "")
+	err = applyConfig(fs, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command line wins over the config.
+	err = fs.Parse([]string{"-retries", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *vendor != "vendor" || *retries != 1 || *timeout != 30*time.Minute || !*noColor {
+		t.Fatalf("Expected %v, but %v:", []interface{}{"vendor", 1, 30 * time.Minute, true}, []interface{}{*vendor, *retries, *timeout, *noColor})
+	}
+
+	for _, c := range []struct {
+		content  string
+		expected string
+	}{
+		{"vendor\n", filename + `:1: expected key=value, but "vendor"`},
+		{"\nfoo = bar\n", filename + ":2: unknown flag foo"},
+		{"retries = many\n", filename + `:1: retries: parse error`},
+	} {
+		err = ioutil.WriteFile(filename, []byte(c.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = applyConfig(fs, filename)
+		if err == nil || err.Error() != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, err)
+		}
+	}
+
+	err = applyConfig(fs, filename+".missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
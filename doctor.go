@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// corruptRepo returns the root of the repository of gom in vendor if its
+// VCS directory is there but the VCS can't read the checked out revision,
+// as when a clone was interrupted, or "".
+func (gom *Gom) corruptRepo(vendor string) string {
+	if _, ok := gom.localPath(); ok {
+		return ""
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	if vcs == nil || vcs.revision == nil {
+		return ""
+	}
+	cmd, done := timedCommand(*timeout, root, vcs.revision)
+	// Don't let git find the repository of the project above a vendor
+	// directory inside it.
+	cmd.Env = append(cmd.Env, "GIT_CEILING_DIRECTORIES="+vendor)
+	if done(cmd.Run()) != nil {
+		return root
+	}
+	return ""
+}
+
+// removeCorrupt removes the corrupt repositories of goms from vendor, so
+// that they are cloned again, and returns the goms they were of.
+func removeCorrupt(goms []Gom, vendor string) ([]Gom, error) {
+	removed := make([]Gom, 0)
+	for _, gom := range goms {
+		root := gom.corruptRepo(vendor)
+		if root == "" {
+			continue
+		}
+		if *dryRun {
+			fmt.Fprintf(stdout, "would remove the corrupt checkout %s\n", root)
+		} else {
+			fmt.Fprintf(stdout, "removing the corrupt checkout %s of %s\n", root, gom.name)
+			if err := os.RemoveAll(root); err != nil {
+				return nil, err
+			}
+		}
+		removed = append(removed, gom)
+	}
+	return removed, nil
+}
+
+// doctor finds the goms whose checkouts are corrupt and installs them again.
+func doctor(args []string) error {
+	args = goArgs(args)
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	vendorGopath = vendor
+
+	// The goms as install installs them, pinned to Gomfile.lock.
+	resolved, _, err := resolveGoms(allGoms, nil)
+	if err != nil {
+		return err
+	}
+	goms, err := removeCorrupt(resolved, vendor)
+	if err != nil {
+		return err
+	}
+	if len(goms) == 0 {
+		fmt.Fprintln(stdout, "no corrupt checkouts found")
+		return nil
+	}
+	for _, gom := range goms {
+		err = gom.Clone(args)
+		if err == nil {
+			err = gom.Checkout()
+		}
+		if err == nil {
+			err = gom.finishCheckout()
+		}
+		if err == nil {
+			err = gom.Build(args)
+		}
+		if err != nil {
+			return err
+		}
+		if !*dryRun {
+			fmt.Fprintf(stdout, "repaired %s\n", gom.name)
+		}
+	}
+	return nil
+}
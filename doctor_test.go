@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRemoveCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	good := filepath.Join(dir, "src", "github.com", "mattn", "gom")
+	initGitRepo(t, good, "https://github.com/mattn/gom.git")
+	bad := filepath.Join(dir, "src", "github.com", "mattn", "go-gtk")
+	initGitRepo(t, bad, "https://github.com/mattn/go-gtk.git")
+	// What an interrupted clone can leave behind.
+	err = os.Remove(filepath.Join(bad, ".git", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goms := []Gom{
+		{name: "github.com/mattn/gom", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-gtk/gtk", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{}},
+	}
+	if root := goms[1].corruptRepo(dir); root != bad {
+		t.Fatalf("Expected %v, but %v:", bad, root)
+	}
+	removed, err := removeCorrupt(goms, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(removed, goms[1:2]) {
+		t.Fatalf("Expected %v, but %v:", goms[1:2], removed)
+	}
+	if isDir(bad) || !isDir(good) {
+		t.Fatal("Expected only the corrupt checkout to be removed")
+	}
+}
+
+func TestDoctorUsesLocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor, oldVendorGopath, oldGomfile, oldDryRun := vendorFolder, vendorGopath, *gomfileFlag, *dryRun
+	defer func() {
+		vendorFolder, vendorGopath, *gomfileFlag, *dryRun = oldVendor, oldVendorGopath, oldGomfile, oldDryRun
+	}()
+	vendorFolder = filepath.Join(dir, "_vendor")
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	*dryRun = true
+
+	bad := filepath.Join(vendorFolder, "src", "github.com", "mattn", "gom")
+	first, _ := initGitRepo(t, bad, "https://github.com/mattn/gom.git")
+	err = os.Remove(filepath.Join(bad, ".git", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(*gomfileFlag, []byte("gom 'github.com/mattn/gom'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(lockfilePath(), []byte("github.com/mattn/gom git "+first+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldstdout := stdout
+	stdout = w
+	err = doctor(nil)
+	w.Close()
+	stdout = oldstdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repaired checkout goes back to the revision Gomfile.lock pins.
+	if !strings.Contains(string(b), first) {
+		t.Fatalf("Expected %v to be checked out, but %v:", first, string(b))
+	}
+}
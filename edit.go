@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// editBranch is the branch gom edit puts a vendored repository on, so the
+// commits made there aren't left on a detached HEAD.
+const editBranch = "gom-edit"
+
+// editBaseKey is the git config key of a vendored repository recording the
+// commit editBranch started from, which gom edit -patch diffs against.
+const editBaseKey = "gom.editbase"
+
+// patchFile returns the absolute path of the patch option of gom, if any,
+// which is relative to the directory of the Gomfile.
+func (gom *Gom) patchFile() (string, bool, error) {
+	patch, ok := gom.options["patch"].(string)
+	if !ok || patch == "" {
+		return "", false, nil
+	}
+	if !filepath.IsAbs(patch) {
+		patch = filepath.Join(filepath.Dir(gomfilePath()), filepath.FromSlash(patch))
+	}
+	p, err := filepath.Abs(patch)
+	return p, true, err
+}
+
+// gomfileRelative returns the path p relative to the directory of the
+// Gomfile, as the patch option gives it.
+func gomfileRelative(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(filepath.Dir(gomfilePath()))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return filepath.ToSlash(abs), nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// patchArgs returns the command applying patch to a checkout of vcs, git
+// apply for git and patch for the others, reverting it with reverse, and
+// only checking that it would succeed with check.
+func patchArgs(vcs *vcsCmd, patch string, check, reverse bool) []string {
+	var args []string
+	if vcs == git {
+		args = []string{"git", "apply"}
+		if check {
+			args = append(args, "--check")
+		}
+	} else {
+		args = []string{"patch", "-p1", "-s", "-f"}
+		if check {
+			args = append(args, "--dry-run")
+		}
+	}
+	if reverse {
+		args = append(args, "-R")
+	}
+	if vcs == git {
+		return append(args, patch)
+	}
+	return append(args, "-i", patch)
+}
+
+// patchApplies returns true if patch could be applied to root, a checkout
+// of vcs, or reverted with reverse.
+func patchApplies(root string, vcs *vcsCmd, patch string, reverse bool) bool {
+	args := patchArgs(vcs, patch, true, reverse)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = root
+	return cmd.Run() == nil
+}
+
+// revertPatch reverts the patch of gom in root, a checkout of vcs, if it is
+// applied, so the checkout of another revision doesn't trip over it.
+func (gom *Gom) revertPatch(root string, vcs *vcsCmd) error {
+	patch, ok, err := gom.patchFile()
+	if err != nil || !ok || *dryRun || !patchApplies(root, vcs, patch, true) {
+		return err
+	}
+	return vcsExec(root, Cyan, patchArgs(vcs, patch, false, true)...)
+}
+
+// ApplyPatch applies the patch option of gom to its checkout, unless it is
+// applied already, so installing again doesn't apply it twice.
+func (gom *Gom) ApplyPatch() error {
+	patch, ok, err := gom.patchFile()
+	if err != nil || !ok {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	if vcs == nil {
+		root = gom.dir(vendor)
+	}
+	if *dryRun {
+		fmt.Fprintf(stdout, "would apply %s to %s\n", patch, gom.name)
+		return nil
+	}
+	args := patchArgs(vcs, patch, false, false)
+	if err := gom.requireTool(args[0]); err != nil {
+		return err
+	}
+	if patchApplies(root, vcs, patch, true) {
+		tracef("%s is already patched with %s\n", gom.name, patch)
+		return nil
+	}
+	if !patchApplies(root, vcs, patch, false) {
+		return fmt.Errorf("%s: patch %s doesn't apply to %s", gom.name, patch, root)
+	}
+	progressf("patching %s with %s\n", gom.name, patch)
+	return vcsExec(root, Cyan, args...)
+}
+
+// editPatch returns the changes made to the repository root since gom edit
+// put it on editBranch, committed or not, new files included.
+func editPatch(root string) (string, error) {
+	base, err := vcsOutput(root, "git", "config", "--get", editBaseKey)
+	if err != nil {
+		return "", fmt.Errorf("%s wasn't made editable by gom edit", root)
+	}
+	// Make the new files part of the diff, without staging their content.
+	_, err = vcsOutput(root, "git", "add", "-A", "-N")
+	if err != nil {
+		return "", err
+	}
+	return vcsOutput(root, "git", "diff", "--binary", strings.TrimSpace(base))
+}
+
+// edit puts the vendored repository of the gom named in args on a branch,
+// so it can be changed and committed to, and prints its directory. With
+// -patch, it writes the changes made there into a file instead, and records
+// it as the patch option of the gom, which install applies after checkout.
+func edit(args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	patch := fs.String("patch", "", "write the changes to this file and record it as the patch of the bundle")
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		return errors.New("usage: gom edit <import path> [-patch file]")
+	}
+	name = normalizeImportPath(name)
+	goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return err
+	}
+	var gom *Gom
+	for i := range goms {
+		if goms[i].name == name {
+			gom = &goms[i]
+		}
+	}
+	if gom == nil {
+		return fmt.Errorf("%s is not in %s", name, gomfilePath())
+	}
+	if _, ok := gom.localPath(); ok {
+		return fmt.Errorf("%s is developed in %s already", name, gom.options["path"])
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	if vcs == nil {
+		return fmt.Errorf("%s is not installed, run gom install first", name)
+	}
+	if vcs != git {
+		return fmt.Errorf("gom edit only supports git, but %s is in a %s repository", name, vcs.name)
+	}
+
+	if *patch != "" {
+		diff, err := editPatch(root)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			return fmt.Errorf("%s has no changes to write to %s", name, *patch)
+		}
+		if *dryRun {
+			fmt.Fprintf(stdout, "would write the changes to %s into %s\n", name, *patch)
+			return nil
+		}
+		err = ioutil.WriteFile(*patch, []byte(diff), 0644)
+		if err != nil {
+			return err
+		}
+		rel, err := gomfileRelative(*patch)
+		if err != nil {
+			return err
+		}
+		return setGomfileEntry(name, []option{{"patch", rel}})
+	}
+
+	branch, err := vcsOutput(root, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	if branch = strings.TrimSpace(branch); branch == "HEAD" {
+		if *dryRun {
+			fmt.Fprintf(stdout, "would put %s on branch %s\n", name, editBranch)
+			return nil
+		}
+		if _, err := vcsOutput(root, "git", "rev-parse", "--verify", "-q", "refs/heads/"+editBranch); err == nil {
+			// Back to the edits of an earlier gom edit.
+			err = vcsExec(root, Cyan, "git", "checkout", "-q", editBranch)
+			if err != nil {
+				return err
+			}
+		} else {
+			base, err := vcs.Revision(root)
+			if err != nil {
+				return err
+			}
+			err = vcsExec(root, Cyan, "git", "checkout", "-q", "-b", editBranch)
+			if err != nil {
+				return err
+			}
+			err = vcsExec(root, Cyan, "git", "config", editBaseKey, base)
+			if err != nil {
+				return err
+			}
+		}
+		progressf("%s is on branch %s\n", name, editBranch)
+	} else if _, err := vcsOutput(root, "git", "config", "--get", editBaseKey); err != nil {
+		// On the branch it is pinned to, which -patch diffs against.
+		base, err := vcs.Revision(root)
+		if err != nil {
+			return err
+		}
+		err = vcsExec(root, Cyan, "git", "config", editBaseKey, base)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println(root)
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor, oldGomfile := vendorFolder, *gomfileFlag
+	defer func() { vendorFolder, *gomfileFlag = oldVendor, oldGomfile }()
+	vendorFolder = filepath.Join(dir, "_vendor")
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(*gomfileFlag, []byte("gom 'github.com/mattn/gom', :commit => 'v1'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(vendorFolder, "src", "github.com", "mattn", "gom")
+	first, _ := initGitRepo(t, repo, "https://github.com/mattn/gom.git")
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=gom", "-c", "user.email=gom@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	// As install leaves a commit pin.
+	run("checkout", "-q", first)
+
+	err = edit([]string{"github.com/mattn/gom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch := run("rev-parse", "--abbrev-ref", "HEAD"); branch != editBranch {
+		t.Fatalf("Expected %v, but %v:", editBranch, branch)
+	}
+	err = ioutil.WriteFile(filepath.Join(repo, "fix.go"), []byte("package gom\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run("add", "fix.go")
+	run("commit", "-q", "-m", "fix")
+	err = ioutil.WriteFile(filepath.Join(repo, "new.go"), []byte("package gom\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patch := filepath.Join(dir, "gom.patch")
+	err = edit([]string{"github.com/mattn/gom", "-patch", patch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(*gomfileFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recorded relative to the Gomfile, not to the current directory.
+	expected := "gom 'github.com/mattn/gom', :commit => 'v1', :patch => 'gom.patch'\n"
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+
+	// Back at the pinned commit, install applies the patch, once.
+	run("reset", "-q", "--hard")
+	run("checkout", "-q", first)
+	run("clean", "-q", "-f")
+	gom := &Gom{name: "github.com/mattn/gom", options: map[string]interface{}{"commit": first, "patch": "gom.patch"}}
+	for i := 0; i < 2; i++ {
+		err = gom.ApplyPatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"fix.go", "new.go"} {
+		if !isFile(filepath.Join(repo, name)) {
+			t.Fatalf("Expected %v to be patched in", name)
+		}
+	}
+	err = gom.revertPatch(repo, git)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isFile(filepath.Join(repo, "fix.go")) {
+		t.Fatal("Expected the patch to be reverted")
+	}
+}
+
+func TestPatchArgs(t *testing.T) {
+	for _, c := range []struct {
+		vcs      *vcsCmd
+		check    bool
+		reverse  bool
+		expected []string
+	}{
+		{git, false, false, []string{"git", "apply", "fix.diff"}},
+		{git, true, true, []string{"git", "apply", "--check", "-R", "fix.diff"}},
+		{hg, false, false, []string{"patch", "-p1", "-s", "-f", "-i", "fix.diff"}},
+		{nil, true, false, []string{"patch", "-p1", "-s", "-f", "--dry-run", "-i", "fix.diff"}},
+		{nil, true, true, []string{"patch", "-p1", "-s", "-f", "--dry-run", "-R", "-i", "fix.diff"}},
+	} {
+		args := patchArgs(c.vcs, "fix.diff", c.check, c.reverse)
+		if !reflect.DeepEqual(args, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, args)
+		}
+	}
+}
+
+func TestApplyPatchWithoutGit(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor, oldGomfile := vendorFolder, *gomfileFlag
+	defer func() { vendorFolder, *gomfileFlag = oldVendor, oldGomfile }()
+	vendorFolder = filepath.Join(dir, "_vendor")
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+
+	// A plain tree, as a url or command gom leaves it.
+	gom := &Gom{name: "example.com/repo", options: map[string]interface{}{"patch": "fix.diff"}}
+	root := gom.dir(vendorFolder)
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := "package repo\n\nconst broken = true\n"
+	err = ioutil.WriteFile(filepath.Join(root, "repo.go"), []byte(original), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "fix.diff"), []byte(`--- a/repo.go
++++ b/repo.go
+@@ -1,3 +1,3 @@
+ package repo
+ 
+-const broken = true
++const broken = false
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() string {
+		b, err := ioutil.ReadFile(filepath.Join(root, "repo.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	// Installing again finds the patch applied with patch --dry-run -R,
+	// and leaves the patched file as it is.
+	for i := 0; i < 2; i++ {
+		err = gom.ApplyPatch()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if expected := "package repo\n\nconst broken = false\n"; read() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, read())
+	}
+	if isFile(filepath.Join(root, "repo.go.orig")) || isFile(filepath.Join(root, "repo.go.rej")) {
+		t.Fatal("Expected patch to leave no .orig or .rej files")
+	}
+
+	// Before another checkout, the patch is reverted, once.
+	for i := 0; i < 2; i++ {
+		err = gom.revertPatch(root, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if read() != original {
+		t.Fatalf("Expected %v, but %v:", original, read())
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// UnsupportedVCSError is returned when gom doesn't know how to check out a
+// revision of a gom, because its VCS isn't one of the supported ones.
+type UnsupportedVCSError struct {
+	Name string
+}
+
+func (e *UnsupportedVCSError) Error() string {
+	return fmt.Sprintf("gom currently support git/hg/bzr/svn/fossil for specifying tag/branch/commit, but can't find any for %s", e.Name)
+}
+
+// MissingToolError is returned when commands needed by goms, like the
+// binary of their VCS, aren't on PATH. Needed maps each command to the goms
+// needing it.
+type MissingToolError struct {
+	Needed map[string][]string
+}
+
+func (e *MissingToolError) Error() string {
+	problems := make([]string, 0, len(e.Needed))
+	for _, tool := range sortedTools(e.Needed) {
+		problems = append(problems, fmt.Sprintf("%s isn't installed, but needed by %s", tool, strings.Join(e.Needed[tool], ", ")))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// FetchError is returned when a command fetching a gom fails.
+type FetchError struct {
+	Args []string
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return redact(fmt.Sprintf("%s: %v", strings.Join(e.Args, " "), e.Err))
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a command is killed for running longer than
+// -timeout.
+type TimeoutError struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return redact(fmt.Sprintf("%s: killed after %v", strings.Join(e.Args, " "), e.Timeout))
+}
+
+// InterruptedError is returned when a command is killed because gom got
+// SIGINT or SIGTERM.
+type InterruptedError struct {
+	Args []string
+}
+
+func (e *InterruptedError) Error() string {
+	return redact(fmt.Sprintf("%s: interrupted", strings.Join(e.Args, " ")))
+}
+
+// CommandError is returned when a command the user asked gom to run, with
+// gom exec, test, build, run or doc, fails. gom exits with its status.
+type CommandError struct {
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// userCommand returns err, the result of a command the user asked gom to
+// run, as a *CommandError unless it is nil.
+func userCommand(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CommandError{err}
+}
+
+// BuildError is returned when go install fails for a gom.
+type BuildError struct {
+	Name string
+	Err  error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("failed to build %s: %v", e.Name, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// ParseError is returned when a Gomfile can't be parsed. Line is 0 when the
+// error can't be attributed to a line, and Text is the offending line when
+// known.
+type ParseError struct {
+	Line int
+	Msg  string
+	Text string
+}
+
+func (e *ParseError) Error() string {
+	s := "Syntax Error"
+	if e.Line > 0 {
+		s += fmt.Sprintf(" at line %d", e.Line)
+	}
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	if e.Text != "" {
+		s += fmt.Sprintf(": %q", e.Text)
+	}
+	return s
+}
+
+// Exit statuses of gom, by failure category. Scripts and CI can check them to
+// tell a flaky network from a broken Gomfile. Commands run through gom exec,
+// test, build, run and doc exit with the status of the command instead.
+const (
+	exitFailure        = 1   // any other failure
+	exitParse          = 2   // the Gomfile can't be parsed
+	exitFetch          = 3   // fetching a gom failed
+	exitUnsupportedVCS = 4   // a revision was given for a gom without a supported VCS
+	exitBuild          = 5   // building a gom failed
+	exitTimeout        = 6   // a command was killed after -timeout
+	exitInterrupted    = 130 // gom got SIGINT, as shells report it, see interruptedStatus
+)
+
+// exitCode returns the exit status gom should exit with after err.
+func exitCode(err error) int {
+	var (
+		pe *ParseError
+		fe *FetchError
+		ue *UnsupportedVCSError
+		be *BuildError
+		ce *CommandError
+		ee *exec.ExitError
+		ie *InterruptedError
+		te *TimeoutError
+	)
+	switch {
+	case errors.As(err, &ie):
+		// Before the others, which may wrap it.
+		return interruptedStatus()
+	case errors.As(err, &te):
+		// Before fetch failures, which may be timeouts.
+		return exitTimeout
+	case errors.As(err, &pe):
+		return exitParse
+	case errors.As(err, &fe):
+		return exitFetch
+	case errors.As(err, &ue):
+		return exitUnsupportedVCS
+	case errors.As(err, &be):
+		return exitBuild
+	case errors.As(err, &ce) && errors.As(ce.Err, &ee) && ee.ExitCode() > 0:
+		// Only the commands of the user, the status of a failed git fetch
+		// would be taken for a signal.
+		return ee.ExitCode()
+	}
+	return exitFailure
+}
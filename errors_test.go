@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestFetchError(t *testing.T) {
+	args := []string{"go", "no-such-command"}
+	err := runRetry("", args, None)
+
+	var fe *FetchError
+	if !errors.As(err, &fe) {
+		t.Fatalf("Expected a FetchError, but %v:", err)
+	}
+	if len(fe.Args) != 2 || fe.Args[1] != "no-such-command" {
+		t.Fatalf("Expected %v, but %v:", args, fe.Args)
+	}
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		t.Fatalf("Expected an ExitError, but %v:", fe.Err)
+	}
+}
+
+func TestUnsupportedVCSError(t *testing.T) {
+	gom := &Gom{name: "example.com/no/such/repo", options: map[string]interface{}{"tag": "v1"}}
+	err := gom.Checkout()
+
+	var ue *UnsupportedVCSError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Expected an UnsupportedVCSError, but %v:", err)
+	}
+	if ue.Name != gom.name {
+		t.Fatalf("Expected %v, but %v:", gom.name, ue.Name)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	exitErr := exec.Command("go", "no-such-command").Run()
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// A failed fetch exits with 3, not the 128 of git, which is a signal's.
+	fetchErr := git.Update(dir)
+	for _, c := range []struct {
+		err      error
+		expected int
+	}{
+		{errors.New("failed"), exitFailure},
+		{&ParseError{Line: 3}, exitParse},
+		{fmt.Errorf("Gomfile: %w", &ParseError{Line: 3}), exitParse},
+		{&FetchError{[]string{"go", "get"}, exitErr}, exitFetch},
+		{&UnsupportedVCSError{"example.com/repo"}, exitUnsupportedVCS},
+		{&BuildError{"example.com/repo", exitErr}, exitBuild},
+		{&FetchError{[]string{"git", "clone"}, &InterruptedError{[]string{"git", "clone"}}}, exitInterrupted},
+		{&CommandError{exitErr}, 2},
+		{userCommand(fmt.Errorf("go test: %w", exitErr)), 2},
+		{exitErr, exitFailure},
+		{fetchErr, exitFetch},
+		{&TimeoutError{[]string{"git", "fetch"}, time.Minute}, exitTimeout},
+		{&FetchError{[]string{"git", "fetch"}, &TimeoutError{[]string{"git", "fetch"}, time.Minute}}, exitTimeout},
+	} {
+		if code := exitCode(c.err); code != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, code)
+		}
+	}
+}
@@ -1,47 +1,97 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/daviddengcn/go-colortext"
+	"io"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path/filepath"
-	"syscall"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Color int
 
+// The output of fetches is blue, of checkouts cyan and of builds green, and
+// warnings are yellow and errors red. Commands run for the user, like go
+// test, keep their own colors.
 const (
-	None Color = Color(ct.None)
-	Red  Color = Color(ct.Red)
-	Blue Color = Color(ct.Blue)
+	None   Color = Color(ct.None)
+	Red    Color = Color(ct.Red)
+	Green  Color = Color(ct.Green)
+	Yellow Color = Color(ct.Yellow)
+	Blue   Color = Color(ct.Blue)
+	Cyan   Color = Color(ct.Cyan)
 )
 
-func handleSignal() {
-	sc := make(chan os.Signal, 10)
-	signal.Notify(sc, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
-	go func() {
-		<-sc
+// useColor is set at startup, unless -no-color or $NO_COLOR is given or
+// the output isn't a terminal.
+var useColor bool
+
+func changeColor(c Color) {
+	if useColor && c != None {
+		ct.ChangeColor(ct.Color(c), true, ct.None, false)
+	}
+}
+
+func resetColor() {
+	if useColor {
 		ct.ResetColor()
-		os.Exit(0)
-	}()
+	}
+}
+
+// warnf prints a warning, in yellow.
+func warnf(format string, a ...interface{}) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	changeColor(Yellow)
+	fmt.Fprintf(stdout, "Warning: "+format, a...)
+	resetColor()
+}
+
+// printError prints the error gom fails with on stderr, in red if that is a
+// terminal too.
+func printError(err error) {
+	color := useColor && isTerminal(os.Stderr)
+	if color {
+		ct.Writer = os.Stderr
+		changeColor(Red)
+	}
+	fmt.Fprintln(os.Stderr, "gom: ", err)
+	if color {
+		resetColor()
+		ct.Writer = stdout
+	}
 }
 
-func ready() error {
+// vendorGopath replaces $GOPATH at the end of the GOPATH the commands gom
+// runs see, once a task installing into the vendor directory sets it. The
+// environment of gom itself is never changed.
+var vendorGopath string
+
+// commandGopath returns the GOPATH of the commands gom runs: the vendor
+// directory and the project directory, found by walking up to the Gomfile,
+// followed by $GOPATH or vendorGopath.
+func commandGopath() (string, error) {
 	dir, err := os.Getwd()
 	if err != nil {
-		return err
+		return "", err
 	}
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
-		return err
+		return "", err
 	}
 	for {
-		file := filepath.Join(dir, "Gomfile")
-		if isFile(file) {
-			vendor = filepath.Join(dir, vendorFolder) +
-				string(filepath.ListSeparator) +
-				dir
+		if isFile(filepath.Join(dir, "Gomfile")) || isFile(filepath.Join(dir, "Gomfile.toml")) {
+			if !filepath.IsAbs(vendorFolder) {
+				vendor = filepath.Join(dir, vendorFolder)
+			}
+			vendor += string(filepath.ListSeparator) + dir
 			break
 		}
 		next := filepath.Clean(filepath.Join(dir, ".."))
@@ -50,29 +100,347 @@ func ready() error {
 		}
 		dir = next
 	}
-	vendor += string(filepath.ListSeparator) + os.Getenv("GOPATH")
-	err = os.Setenv("GOPATH", vendor)
+	base := vendorGopath
+	if base == "" {
+		base = os.Getenv("GOPATH")
+	}
+	return vendor + string(filepath.ListSeparator) + base, nil
+}
+
+// commandEnv returns the environment of the commands gom runs, that of gom
+// with GOPATH set to commandGopath, or left as is if commandGopath fails.
+func commandEnv() []string {
+	gopath, err := commandGopath()
 	if err != nil {
-		return err
+		return os.Environ()
 	}
-	return nil
+	env := make([]string, 0)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GOPATH=") {
+			env = append(env, kv)
+		}
+	}
+	return append(env, "GOPATH="+gopath)
 }
 
+var stdin = os.Stdin
 var stdout = os.Stdout
 var stderr = os.Stderr
 
+// parallel is set while commands may run concurrently. Their output is then
+// buffered and written in one block, under outputMu, once they are done.
+var parallel bool
+
+var outputMu sync.Mutex
+
+// flushOutput writes the buffered output of a command in color c.
+func flushOutput(c Color, out, errOut string) {
+	if out == "" && errOut == "" {
+		return
+	}
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	changeColor(c)
+	io.WriteString(stdout, redact(out))
+	io.WriteString(stderr, redact(errOut))
+	resetColor()
+}
+
+var secretsMu sync.Mutex
+
+// secrets are the strings, such as access tokens, gom must never print.
+var secrets []string
+
+func addSecret(secret string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if secret != "" && !has(secrets, secret) {
+		secrets = append(secrets, secret)
+	}
+}
+
+// redact returns s with the secrets in it masked.
+func redact(s string) string {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, "***", -1)
+	}
+	return s
+}
+
+func hasSecrets() bool {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	return len(secrets) > 0
+}
+
+// redactWriter masks the secrets written through it. Secrets split across
+// writes get through, which the line buffered output of git avoids.
+type redactWriter struct {
+	w io.Writer
+}
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(r.w, redact(string(p)))
+	return len(p), err
+}
+
+// goCommand returns the go tool to run: the one given with -go or in
+// $GOM_GO, or else go from PATH.
+func goCommand() string {
+	switch {
+	case *goFlag != "":
+		return *goFlag
+	case os.Getenv("GOM_GO") != "":
+		return os.Getenv("GOM_GO")
+	}
+	return "go"
+}
+
+// progressf prints the progress of a step, unless -q is given.
+func progressf(format string, a ...interface{}) {
+	if !*quiet {
+		fmt.Fprintf(stdout, format, a...)
+	}
+}
+
+// tracef prints a command about to be run, if -v is given.
+func tracef(format string, a ...interface{}) {
+	if *verbose {
+		fmt.Fprint(stdout, redact(fmt.Sprintf(format, a...)))
+	}
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// timedCommand returns the command running args in dir, killed once limit
+// has elapsed unless it is 0. done must be called with the result of the
+// command, and returns a *TimeoutError if the command was killed.
+func timedCommand(limit time.Duration, dir string, args []string) (cmd *exec.Cmd, done func(error) error) {
+	ctx, cancel := context.WithCancel(interrupted)
+	if limit > 0 {
+		ctx, cancel = context.WithTimeout(interrupted, limit)
+	}
+	cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = commandEnv()
+	// Don't wait for children of the command holding its output open.
+	cmd.WaitDelay = time.Second
+	setProcessGroup(cmd)
+	atomic.AddInt32(&running, 1)
+	return cmd, func(err error) error {
+		defer atomic.AddInt32(&running, -1)
+		defer cancel()
+		if err != nil && interrupted.Err() != nil {
+			return &InterruptedError{args}
+		}
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return &TimeoutError{args, limit}
+		}
+		return err
+	}
+}
+
+// splitCommand splits the command line s into arguments as a shell does,
+// without expanding anything: on spaces outside of quotes, with the quotes
+// removed. Single quotes keep everything as written, and a backslash keeps
+// the character after it, except in single quotes, and in double quotes
+// where it only escapes a double quote or a backslash.
+func splitCommand(s string) ([]string, error) {
+	args := make([]string, 0)
+	var arg []byte
+	inArg := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg = append(arg, c)
+			}
+		case c == '\\' && i+1 < len(s) && (quote == 0 || s[i+1] == '"' || s[i+1] == '\\'):
+			i++
+			arg = append(arg, s[i])
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg = append(arg, c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg || len(arg) > 0 {
+				args = append(args, string(arg))
+			}
+			arg, inArg = nil, false
+		default:
+			arg = append(arg, c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %s", quote, s)
+	}
+	if inArg || len(arg) > 0 {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// run runs a command of the user, such as go test, without time limit.
 func run(args []string, c Color) error {
-	if err := ready(); err != nil {
+	return runTee("", args, c, nil, 0)
+}
+
+// runTee is like run, but runs the command in dir unless it is empty, kills
+// it after limit unless it is 0, and also copies the standard error of the
+// command into w if it isn't nil.
+func runTee(dir string, args []string, c Color, w io.Writer, limit time.Duration) error {
+	if _, err := commandGopath(); err != nil {
 		return err
 	}
 	if len(args) == 0 {
 		usage()
 	}
-	cmd := exec.Command(args[0], args[1:]...)
+	if *dryRun {
+		fmt.Fprintf(stdout, "would run: %s\n", redact(strings.Join(args, " ")))
+		return nil
+	}
+	if dir != "" {
+		tracef("+ cd %s\n", dir)
+	}
+	tracef("+ %s\n", strings.Join(args, " "))
+	cmd, done := timedCommand(limit, dir, args)
+	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
-	ct.ChangeColor(ct.Color(c), true, ct.None, false)
+	var outBuf, errBuf bytes.Buffer
+	if parallel {
+		cmd.Stdout = &outBuf
+		cmd.Stderr = &errBuf
+	} else if hasSecrets() {
+		// Only then, as the command no longer gets the terminal itself.
+		cmd.Stdout = redactWriter{stdout}
+		cmd.Stderr = redactWriter{stderr}
+	}
+	if w != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, w)
+	}
+	if parallel {
+		err := cmd.Run()
+		flushOutput(c, outBuf.String(), errBuf.String())
+		return done(err)
+	}
+	changeColor(c)
 	err := cmd.Run()
-	ct.ResetColor()
+	resetColor()
+	return done(err)
+}
+
+// networkErrors are fragments of the messages git, hg, bzr and go get print
+// when they fail because of the network rather than the request itself.
+var networkErrors = []string{
+	"could not resolve host",
+	"no such host",
+	"temporary failure in name resolution",
+	"connection timed out",
+	"connection refused",
+	"connection reset",
+	"operation timed out",
+	"i/o timeout",
+	"network is unreachable",
+	"tls handshake timeout",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"http 502",
+	"http 503",
+	"http 504",
+}
+
+func isNetworkError(output string) bool {
+	output = strings.ToLower(output)
+	for _, s := range networkErrors {
+		if strings.Contains(output, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// authErrors are fragments of the messages git and ssh print when the host
+// was reached but refused the credentials, or got none.
+var authErrors = []string{
+	"permission denied (publickey",
+	"host key verification failed",
+	"authentication failed",
+	"could not read username",
+	"could not read password",
+	"invalid username or password",
+	"returned error: 401",
+	"returned error: 403",
+}
+
+func isAuthError(output string) bool {
+	if isNetworkError(output) {
+		return false
+	}
+	output = strings.ToLower(output)
+	for _, s := range authErrors {
+		if strings.Contains(output, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is how long the first retry of a fetch waits, doubled for each
+// retry after it.
+var retryDelay = time.Second
+
+// runRetry is like run, but runs the command in dir unless it is empty,
+// kills it after -timeout, and retries it with exponential backoff, up to
+// *retries times, while it fails with a network error. It is meant for
+// fetches, whose failures are returned as a *FetchError.
+func runRetry(dir string, args []string, c Color) error {
+	_, err := runRetryOutput(dir, args, c)
 	return err
 }
+
+// runRetryOutput is like runRetry, and also returns the standard error of
+// the last attempt, to tell why it failed.
+func runRetryOutput(dir string, args []string, c Color) (string, error) {
+	return retryOutput(dir, args, c, nil)
+}
+
+// retryOutput is runRetryOutput calling reset, unless it is nil, before
+// each retry, to undo what the failed attempt left behind.
+func retryOutput(dir string, args []string, c Color, reset func() error) (string, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		var buf bytes.Buffer
+		err := runTee(dir, args, c, &buf, *timeout)
+		if err == nil {
+			return buf.String(), nil
+		}
+		if attempt >= *retries || !isNetworkError(buf.String()) {
+			return buf.String(), &FetchError{args, err}
+		}
+		if reset != nil {
+			if rerr := reset(); rerr != nil {
+				return buf.String(), rerr
+			}
+		}
+		progressf("retrying %s in %v\n", redact(strings.Join(args, " ")), delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
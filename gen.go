@@ -4,13 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"go/build"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 )
 
 const travis_yml = ".travis.yml"
 
+// generator returns what gom gen name generates, the Gomfile when no name is
+// given, or nil for an unknown name.
+func generator(name string) func() error {
+	switch name {
+	case "travis-yml":
+		return genTravisYml
+	case "", "gomfile":
+		return genGomfile
+	}
+	return nil
+}
+
 func genTravisYml() error {
 	_, err := os.Stat(travis_yml)
 	if err == nil {
@@ -47,62 +62,135 @@ func appendPkg(pkgs []string, pkg string) []string {
 	return append(pkgs, pkg)
 }
 
-func appendPkgs(pkgs, more []string) []string {
-	for _, pkg := range more {
-		pkgs = appendPkg(pkgs, pkg)
+// repoHosts maps the hosts whose repositories are at a fixed depth to the
+// number of elements of a repository root.
+var repoHosts = map[string]int{
+	"github.com":        3,
+	"bitbucket.org":     3,
+	"gitlab.com":        3,
+	"code.google.com":   3,
+	"golang.org":        3,
+	"launchpad.net":     2,
+	"gopkg.in":          2,
+	"google.golang.org": 2,
+}
+
+// repoRoot returns the root of the repository holding the package path,
+// such as github.com/mattn/go-sqlite3 for github.com/mattn/go-sqlite3/sqlite3.
+// Paths on unknown hosts are returned as they are.
+func repoRoot(path string) string {
+	elems := strings.Split(path, "/")
+	n, ok := repoHosts[elems[0]]
+	if !ok {
+		return path
+	}
+	if elems[0] == "gopkg.in" && len(elems) > 2 && !strings.Contains(elems[1], ".") {
+		// gopkg.in/user/pkg.v1 rather than gopkg.in/pkg.v1
+		n = 3
 	}
-	return pkgs
+	if len(elems) < n {
+		return path
+	}
+	return strings.Join(elems[:n], "/")
 }
 
-func scanDirectory(path, srcDir string) (ret []string, err error) {
-	pkg, err := build.Import(path, srcDir, build.AllowBinary)
+// goModModule returns the module the go.mod file filename declares, or "".
+func goModModule(filename string) string {
+	b, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return ret, err
+		return ""
 	}
-
-	for _, imp := range pkg.Imports {
-		switch {
-		case isStandardImport(imp):
-			// Ignore standard packages
-		case !build.IsLocalImport(imp):
-			// Add the external package
-			ret = appendPkg(ret, imp)
-			fallthrough
-		default:
-			// Does the recursive walk
-			pkgs, err := scanDirectory(imp, pkg.Dir)
-			if err != nil {
-				return ret, err
-			}
-			ret = appendPkgs(ret, pkgs)
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
 		}
 	}
-
-	return ret, err
+	return ""
 }
 
-func genGomfile() error {
-	_, err := os.Stat("Gomfile")
-	if err == nil {
-		return errors.New("Gomfile already exists")
+// ownModule returns the import path of the project in the current
+// directory, from its go.mod or its location in GOPATH, or "".
+func ownModule() string {
+	if module := goModModule(gomod); module != "" {
+		return module
 	}
-	f, err := os.Create("Gomfile")
+	module, err := modulePath()
 	if err != nil {
-		return err
+		return ""
 	}
-	defer f.Close()
+	return module
+}
 
-	dir, err := os.Getwd()
+// scanImports returns the repository roots of the packages imported by the
+// packages below root, leaving out standard packages and the ones of module.
+// Build constraints are ignored, so the imports of every platform are
+// found.
+func scanImports(root, module string) ([]string, error) {
+	dirs, err := packageDirs(root)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	all, err := scanDirectory(".", dir)
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]string, 0)
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil && (abs == vendor || strings.HasPrefix(abs, vendor+string(filepath.Separator))) {
+			continue
+		}
+		imports, err := packageImports(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range imports {
+			if isStandardImport(imp) || build.IsLocalImport(imp) {
+				continue
+			}
+			if module != "" && (imp == module || strings.HasPrefix(imp, module+"/")) {
+				continue
+			}
+			repos = appendPkg(repos, repoRoot(imp))
+		}
+	}
+	sort.Strings(repos)
+	return repos, nil
+}
+
+// genGomfile writes Gomfile, or the file given with -gomfile, or stdout if
+// that is -, declaring the repositories imported below the current
+// directory.
+func genGomfile() error {
+	filename := "Gomfile"
+	if *gomfileFlag != "" {
+		filename = *gomfileFlag
+	}
+	if filename != stdinGomfile {
+		_, err := os.Stat(filename)
+		if err == nil {
+			return fmt.Errorf("%s already exists", filename)
+		}
+	}
+	repos, err := scanImports(".", ownModule())
 	if err != nil {
 		return err
 	}
-	sort.Strings(all)
-	for _, pkg := range all {
-		fmt.Fprintf(f, "gom '%s'\n", pkg)
+	w := io.Writer(os.Stdout)
+	if filename != stdinGomfile {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	for _, repo := range repos {
+		if strings.HasSuffix(filename, ".toml") {
+			fmt.Fprintf(w, "[[gom]]\nname = %q\n\n", repo)
+		} else {
+			fmt.Fprintf(w, "gom '%s'\n", repo)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerator(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected func() error
+	}{
+		{"", genGomfile},
+		{"gomfile", genGomfile},
+		{"travis-yml", genTravisYml},
+		{"unknown", nil},
+	} {
+		generate := generator(c.name)
+		if reflect.ValueOf(generate).Pointer() != reflect.ValueOf(c.expected).Pointer() {
+			t.Fatalf("Expected gom gen %q to run its generator, but another:", c.name)
+		}
+	}
+}
+
+func TestRepoRoot(t *testing.T) {
+	for _, c := range []struct {
+		path     string
+		expected string
+	}{
+		{"github.com/mattn/go-sqlite3", "github.com/mattn/go-sqlite3"},
+		{"github.com/mattn/go-gtk/gtk", "github.com/mattn/go-gtk"},
+		{"golang.org/x/net/context", "golang.org/x/net"},
+		{"gopkg.in/yaml.v2", "gopkg.in/yaml.v2"},
+		{"gopkg.in/check.v1/sub", "gopkg.in/check.v1"},
+		{"gopkg.in/mattn/go-colorable.v0", "gopkg.in/mattn/go-colorable.v0"},
+		{"launchpad.net/gocheck", "launchpad.net/gocheck"},
+		{"example.com/any/depth/pkg", "example.com/any/depth/pkg"},
+	} {
+		if root := repoRoot(c.path); root != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, root)
+		}
+	}
+}
+
+func TestScanImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor := vendorFolder
+	defer func() { vendorFolder = oldVendor }()
+	vendorFolder = filepath.Join(dir, "vendor")
+
+	files := map[string]string{
+		"main.go": `package main
+
+import (
+	"fmt"
+	"example.com/project/util"
+	"github.com/mattn/go-gtk/gtk"
+	"github.com/mattn/go-gtk/glib"
+)
+`,
+		"main_windows.go": `// +build windows
+
+package main
+
+import "github.com/mattn/go-ole"
+`,
+		"util/util.go": `package util
+
+import "golang.org/x/net/context"
+`,
+		"vendor/src/example.com/dep/dep.go": `package dep
+
+import "github.com/mattn/go-runewidth"
+`,
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := scanImports(dir, "example.com/project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"github.com/mattn/go-gtk", "github.com/mattn/go-ole", "golang.org/x/net"}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, repos)
+	}
+}
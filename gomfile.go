@@ -2,20 +2,31 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"github.com/BurntSushi/toml"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 var qx = `'[^']*'|"[^"]*"`
 var kx = `:[a-z][a-z0-9_]*`
-var ax = `(?:\s*` + kx + `\s*|,\s*` + kx + `\s*)`
-var re_group = regexp.MustCompile(`\s*group\s+((?:` + kx + `\s*|,\s*` + kx + `\s*)*)\s*do\s*$`)
+var gx = `:!?[a-z][a-z0-9_]*`
+var ax = `(?:\s*` + gx + `\s*|,\s*` + gx + `\s*)`
+var re_group = regexp.MustCompile(`\s*group\s+((?:` + gx + `\s*|,\s*` + gx + `\s*)*)\s*do\s*$`)
 var re_end = regexp.MustCompile(`\s*end\s*$`)
 var re_gom = regexp.MustCompile(`^\s*gom\s+(` + qx + `)\s*((?:,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*))*)$`)
+var re_setting = regexp.MustCompile(`^\s*(pre_install|post_install|ssh_hosts|default_branches|include)\s+(` + qx + `)\s*$`)
 var re_options = regexp.MustCompile(`(,\s*` + kx + `\s*=>\s*(?:` + qx + `|\s*\[\s*` + ax + `*\s*\]\s*)\s*)`)
 
 func unquote(name string) string {
@@ -28,40 +39,89 @@ func unquote(name string) string {
 	return name
 }
 
-func matchOS(any interface{}) bool {
-	var envs []string
+// optionValues returns the values of an option given either as a list or
+// as a comma separated string, such as :goos => 'darwin,linux'.
+func optionValues(any interface{}) []string {
 	if as, ok := any.([]string); ok {
-		envs = as
+		return as
 	} else if s, ok := any.(string); ok {
-		envs = []string{s}
-	} else {
-		return false
+		return splitGroups(s)
 	}
+	return nil
+}
 
-	if has(envs, runtime.GOOS) {
-		return true
+func matchOS(any interface{}) bool {
+	return has(optionValues(any), runtime.GOOS)
+}
+
+func matchArch(any interface{}) bool {
+	return has(optionValues(any), runtime.GOARCH)
+}
+
+// splitGroups splits a comma separated list of groups, as given to -groups
+// and -without.
+func splitGroups(s string) []string {
+	groups := make([]string, 0)
+	for _, g := range strings.Split(s, ",") {
+		g = strings.TrimPrefix(strings.TrimSpace(g), ":")
+		if g != "" {
+			groups = append(groups, g)
+		}
 	}
-	return false
+	return groups
 }
-func matchEnv(any interface{}) bool {
-	var envs []string
-	if as, ok := any.([]string); ok {
-		envs = as
-	} else if s, ok := any.(string); ok {
-		envs = []string{s}
+
+// activeGroups returns the groups whose goms are installed: the ones given
+// with -groups or else the ones of the environment flags, minus the ones
+// given with -without.
+func activeGroups() []string {
+	var groups []string
+	if *groupsFlag != "" {
+		groups = splitGroups(*groupsFlag)
 	} else {
-		return false
+		if *productionEnv {
+			groups = append(groups, "production")
+		}
+		if *developmentEnv {
+			groups = append(groups, "development")
+		}
+		if *testEnv {
+			groups = append(groups, "test")
+		}
+	}
+	without := splitGroups(*withoutFlag)
+	active := make([]string, 0)
+	for _, g := range groups {
+		if !has(without, g) {
+			active = append(active, g)
+		}
 	}
+	return active
+}
 
-	switch {
-	case has(envs, "production") && *productionEnv:
-		return true
-	case has(envs, "development") && *developmentEnv:
-		return true
-	case has(envs, "test") && *testEnv:
-		return true
+// matchEnv returns true if the groups of a gom, or of a group block, are
+// installed. A group prefixed with ! excludes the gom from that group, and
+// takes precedence: the gom is left out when any of its negated groups is
+// active, whatever the others. Otherwise it is installed if one of its
+// groups is active, or if it has only negated ones, so :group => '!production'
+// installs it everywhere but in production.
+func matchEnv(any interface{}) bool {
+	active := activeGroups()
+	positive := false
+	matched := false
+	for _, env := range optionValues(any) {
+		if strings.HasPrefix(env, "!") {
+			if has(active, strings.TrimPrefix(env[1:], ":")) {
+				return false
+			}
+			continue
+		}
+		positive = true
+		if has(active, env) {
+			matched = true
+		}
 	}
-	return false
+	return matched || !positive
 }
 
 func parseOptions(line string, options map[string]interface{}) {
@@ -90,19 +150,323 @@ func parseOptions(line string, options map[string]interface{}) {
 	}
 }
 
+// warnedEnv are the unset variables Gomfiles were already warned about.
+var warnedEnv = make(map[string]bool)
+
+// expandEnv expands the $VAR and ${VAR} of s from the environment. Unset
+// variables expand to empty, with a warning naming them and the gom.
+func expandEnv(name, s string) string {
+	return os.Expand(s, func(key string) string {
+		value, ok := os.LookupEnv(key)
+		if !ok && !warnedEnv[key] {
+			warnedEnv[key] = true
+			warnf("$%s of %s isn't set, it expands to nothing\n", key, name)
+		}
+		return value
+	})
+}
+
+// expandOptions expands the environment variables in the option values of
+// the gom name.
+func expandOptions(name string, options map[string]interface{}) {
+	for key, value := range options {
+		switch v := value.(type) {
+		case string:
+			options[key] = expandEnv(name, v)
+		case []string:
+			for i := range v {
+				v[i] = expandEnv(name, v[i])
+			}
+		}
+	}
+}
+
 type Gom struct {
 	name    string
 	options map[string]interface{}
 }
 
+// gomfilePath returns the Gomfile given with -gomfile, or else the one of
+// the current directory, preferring Gomfile.toml when both exist.
+func gomfilePath() string {
+	if *gomfileFlag != "" {
+		return *gomfileFlag
+	}
+	if isFile("Gomfile.toml") {
+		return "Gomfile.toml"
+	}
+	return "Gomfile"
+}
+
 func parseGomfile(filename string) ([]Gom, error) {
-	f, err := os.Open(filename)
+	goms, err := parseGomfileGroups(filename, matchEnv)
 	if err != nil {
 		return nil, err
 	}
-	br := bufio.NewReader(f)
+	return mergeGoms(goms)
+}
+
+// normalizeImportPath returns name without trailing or doubled slashes, and
+// with its host in lower case, as hosts are case insensitive.
+func normalizeImportPath(name string) string {
+	name = strings.TrimRight(name, "/")
+	if name == "" {
+		return name
+	}
+	name = path.Clean(name)
+	elems := strings.SplitN(name, "/", 2)
+	elems[0] = strings.ToLower(elems[0])
+	return strings.Join(elems, "/")
+}
+
+// mergeGoms merges the goms declared more than once. A declaration in a
+// group that isn't installed is left out. The others are merged into the
+// first one, their groups added up, but must not differ in any other option,
+// such as the revision to check out.
+func mergeGoms(goms []Gom) ([]Gom, error) {
+	merged := make([]Gom, 0, len(goms))
+	index := make(map[string]int)
+	for _, gom := range goms {
+		i, seen := index[gom.name]
+		if !seen {
+			index[gom.name] = len(merged)
+			merged = append(merged, gom)
+			continue
+		}
+		first := merged[i]
+		if group, ok := gom.options["group"]; ok && !matchEnv(group) {
+			continue
+		}
+		if group, ok := first.options["group"]; ok && !matchEnv(group) {
+			merged[i] = gom
+			continue
+		}
+		if a, b := versionOf(&first), versionOf(&gom); a != "" && b != "" && a != b {
+			return nil, &ParseError{Msg: fmt.Sprintf("%s is declared with conflicting versions %s and %s", gom.name, a, b)}
+		}
+		for key, value := range gom.options {
+			old, ok := first.options[key]
+			switch {
+			case !ok:
+				first.options[key] = value
+			case key == "group":
+				groups := optionValues(old)
+				for _, g := range optionValues(value) {
+					groups = appendPkg(groups, g)
+				}
+				first.options[key] = groups
+			case !reflect.DeepEqual(old, value) && !has(versionKeys, key):
+				return nil, &ParseError{Msg: fmt.Sprintf("%s is declared with conflicting %s options %s and %s", gom.name, key, formatOption(old), formatOption(value))}
+			}
+		}
+	}
+	return merged, nil
+}
+
+// versionKeys are the options giving the revision of a gom to check out.
+var versionKeys = []string{"branch", "tag", "commit", "ref"}
+
+// versionOf describes the revision gom is pinned to, as in tag v1, or "".
+func versionOf(gom *Gom) string {
+	keys := versionOptions(gom)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s %v", key, formatOption(gom.options[key])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// anyGroup matches every group, for commands that must see the goms of
+// all environments.
+func anyGroup(interface{}) bool {
+	return true
+}
+
+// settings are the top level settings of a Gomfile, by name: the commands
+// of the pre_install and post_install hooks to run before and after
+// install, the ssh_hosts private repositories are cloned from over SSH, the
+// default_branches of hosts, and the Gomfiles to include.
+type settings map[string][]string
+
+// run runs the hooks of phase in order, from the directory of the Gomfile
+// and with the GOPATH of install, stopping at the first failing one. Each
+// hook is split into arguments with splitCommand, not run by a shell.
+func (h settings) run(phase string) error {
+	for _, hook := range h[phase] {
+		args, err := splitCommand(hook)
+		if err != nil {
+			return fmt.Errorf("%s hook: %v", phase, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		progressf("running %s hook %s\n", phase, hook)
+		err = runTee(filepath.Dir(gomfilePath()), args, None, nil, 0)
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %w", phase, hook, err)
+		}
+	}
+	return nil
+}
+
+// sshHosts returns the host patterns of ssh_hosts, each setting being a
+// comma separated list of them.
+func (h settings) sshHosts() []string {
+	hosts := make([]string, 0)
+	for _, s := range h["ssh_hosts"] {
+		hosts = append(hosts, splitGroups(s)...)
+	}
+	return hosts
+}
+
+// hostBranch is the branch checked out for the goms on a host matching
+// pattern, that aren't pinned to any revision.
+type hostBranch struct {
+	pattern string
+	branch  string
+}
+
+// parseHostBranches parses a comma separated list of pattern=branch pairs.
+func parseHostBranches(s string) ([]hostBranch, error) {
+	defaults := make([]hostBranch, 0)
+	for _, pair := range splitGroups(s) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("expected host=branch, but %q", pair)
+		}
+		defaults = append(defaults, hostBranch{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+	}
+	return defaults, nil
+}
+
+// defaultBranches returns the host patterns of default_branches with their
+// branch, in order.
+func (h settings) defaultBranches() ([]hostBranch, error) {
+	defaults := make([]hostBranch, 0)
+	for _, s := range h["default_branches"] {
+		d, err := parseHostBranches(s)
+		if err != nil {
+			return nil, fmt.Errorf("default_branches: %v", err)
+		}
+		defaults = append(defaults, d...)
+	}
+	return defaults, nil
+}
+
+// parseSettings returns the settings of filename, leaving out the ones in
+// the group blocks of groups that aren't installed.
+func parseSettings(filename string) (settings, error) {
+	_, h, err := parseGomfileFile(filename, matchEnv)
+	return h, err
+}
+
+// parseGomfileGroups parses filename, skipping the group blocks whose
+// groups are rejected by match.
+func parseGomfileGroups(filename string, match func(interface{}) bool) ([]Gom, error) {
+	goms, _, err := parseGomfileFile(filename, match)
+	return goms, err
+}
+
+// stdinGomfile is the name given to -gomfile to read the Gomfile from
+// stdin. It is read once, and parsed again from memory after that.
+const stdinGomfile = "-"
+
+var (
+	stdinOnce    sync.Once
+	stdinContent []byte
+	stdinErr     error
+)
+
+func readStdinGomfile() ([]byte, error) {
+	stdinOnce.Do(func() {
+		stdinContent, stdinErr = ioutil.ReadAll(os.Stdin)
+	})
+	return stdinContent, stdinErr
+}
+
+// parseGomfileFile parses filename and the Gomfiles it includes, relative
+// to its directory. The goms of the included Gomfiles come first, except
+// those filename declares itself, which override them, and so do their
+// settings.
+func parseGomfileFile(filename string, match func(interface{}) bool) ([]Gom, settings, error) {
+	return parseIncludingGomfile(filename, match, nil)
+}
+
+// parseIncludingGomfile is parseGomfileFile for filename included through
+// the Gomfiles of chain.
+func parseIncludingGomfile(filename string, match func(interface{}) bool, chain []string) ([]Gom, settings, error) {
+	goms, h, err := parseOneGomfile(filename, match)
+	if err != nil || len(h["include"]) == 0 {
+		return goms, h, err
+	}
+	dir := "."
+	if filename != stdinGomfile {
+		dir = filepath.Dir(filename)
+	}
+	chain = append(append([]string{}, chain...), filepath.Clean(filename))
+	declared := make(map[string]bool)
+	for _, gom := range goms {
+		declared[gom.name] = true
+	}
+
+	all := make([]Gom, 0)
+	merged := make(settings)
+	for _, include := range h["include"] {
+		p := filepath.FromSlash(include)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if has(chain, filepath.Clean(p)) {
+			return nil, nil, &ParseError{Msg: fmt.Sprintf("%s includes itself through %s", p, filename)}
+		}
+		included, ih, err := parseIncludingGomfile(p, match, chain)
+		if err != nil {
+			var pe *ParseError
+			if errors.As(err, &pe) {
+				return nil, nil, fmt.Errorf("%s: %w", p, err)
+			}
+			return nil, nil, err
+		}
+		for _, gom := range included {
+			if !declared[gom.name] {
+				all = append(all, gom)
+			}
+		}
+		for key, values := range ih {
+			merged[key] = append(merged[key], values...)
+		}
+	}
+	for key, values := range h {
+		if key != "include" {
+			merged[key] = append(merged[key], values...)
+		}
+	}
+	return append(all, goms...), merged, nil
+}
+
+func parseOneGomfile(filename string, match func(interface{}) bool) ([]Gom, settings, error) {
+	if strings.HasSuffix(filename, ".toml") {
+		return parseTomlGomfile(filename)
+	}
+	var r io.Reader
+	if filename == stdinGomfile {
+		b, err := readStdinGomfile()
+		if err != nil {
+			return nil, nil, err
+		}
+		r = bytes.NewReader(b)
+	} else {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
 
 	goms := make([]Gom, 0)
+	h := make(settings)
 
 	n := 0
 	skip := 0
@@ -112,9 +476,9 @@ func parseGomfile(filename string) ([]Gom, error) {
 		lb, _, err := br.ReadLine()
 		if err != nil {
 			if err == io.EOF {
-				return goms, nil
+				return goms, h, nil
 			}
-			return nil, err
+			return nil, nil, err
 		}
 		line := strings.TrimSpace(string(lb))
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -129,7 +493,7 @@ func parseGomfile(filename string) ([]Gom, error) {
 			for i := range envs {
 				envs[i] = strings.TrimSpace(envs[i])[1:]
 			}
-			if matchEnv(envs) {
+			if match(envs) {
 				valid = true
 				continue
 			}
@@ -140,21 +504,103 @@ func parseGomfile(filename string) ([]Gom, error) {
 			if !valid {
 				skip--
 				if skip < 0 {
-					return nil, fmt.Errorf("Syntax Error at line %d", n)
+					return nil, nil, &ParseError{Line: n, Msg: "end without group", Text: line}
 				}
 			}
 			valid = false
 			continue
 		} else if skip > 0 {
 			continue
+		} else if m := re_setting.FindStringSubmatch(line); m != nil {
+			h[m[1]] = append(h[m[1]], unquote(m[2]))
+			continue
 		} else if re_gom.MatchString(line) {
 			items = re_gom.FindStringSubmatch(line)[1:]
 			name = unquote(items[0])
 			parseOptions(items[1], options)
 		} else {
-			return nil, fmt.Errorf("Syntax Error at line %d", n)
+			return nil, nil, &ParseError{Line: n, Text: line}
+		}
+		expandOptions(name, options)
+		goms = append(goms, Gom{normalizeImportPath(name), options})
+	}
+	return goms, h, nil
+}
+
+// parseTomlGomfile parses a Gomfile in TOML, where each gom is a [[gom]]
+// table. Values are converted to the types the line based parser produces,
+// so the rest of gom can't tell the two formats apart. The settings are top
+// level keys, each a string or a list of them.
+func parseTomlGomfile(filename string) ([]Gom, settings, error) {
+	var file struct {
+		Goms        []map[string]interface{} `toml:"gom"`
+		PreInstall  interface{}              `toml:"pre_install"`
+		PostInstall interface{}              `toml:"post_install"`
+		SSHHosts    interface{}              `toml:"ssh_hosts"`
+		Branches    interface{}              `toml:"default_branches"`
+		Include     interface{}              `toml:"include"`
+	}
+	_, err := toml.DecodeFile(filename, &file)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return nil, nil, err
+		}
+		var te toml.ParseError
+		if errors.As(err, &te) {
+			return nil, nil, &ParseError{Line: te.Position.Line, Msg: te.Message}
+		}
+		return nil, nil, &ParseError{Msg: err.Error()}
+	}
+
+	goms := make([]Gom, 0)
+	for i, table := range file.Goms {
+		name, ok := table["name"].(string)
+		if !ok || name == "" {
+			return nil, nil, &ParseError{Msg: fmt.Sprintf("gom #%d has no name", i+1)}
+		}
+		options := make(map[string]interface{})
+		for key, value := range table {
+			if key == "name" {
+				continue
+			}
+			switch v := value.(type) {
+			case string:
+				options[key] = v
+			case bool:
+				options[key] = strconv.FormatBool(v)
+			case int64:
+				options[key] = strconv.FormatInt(v, 10)
+			case []interface{}:
+				a := []string{}
+				for _, e := range v {
+					a = append(a, fmt.Sprint(e))
+				}
+				options[key] = a
+			default:
+				return nil, nil, &ParseError{Msg: fmt.Sprintf("gom #%d has an unsupported value for %s", i+1, key)}
+			}
+		}
+		expandOptions(name, options)
+		goms = append(goms, Gom{normalizeImportPath(name), options})
+	}
+
+	h := make(settings)
+	for key, value := range map[string]interface{}{"pre_install": file.PreInstall, "post_install": file.PostInstall, "ssh_hosts": file.SSHHosts, "default_branches": file.Branches, "include": file.Include} {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			h[key] = []string{v}
+		case []interface{}:
+			for _, e := range v {
+				s, ok := e.(string)
+				if !ok {
+					return nil, nil, &ParseError{Msg: fmt.Sprintf("%s must be a string or a list of them", key)}
+				}
+				h[key] = append(h[key], s)
+			}
+		default:
+			return nil, nil, &ParseError{Msg: fmt.Sprintf("%s must be a string or a list of them", key)}
 		}
-		goms = append(goms, Gom{name, options})
 	}
-	return goms, nil
+	return goms, h, nil
 }
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -128,3 +134,534 @@ gom 'github.com/mattn/gom', :fork => 'github.com/dicefm/gom'
 		t.Fatalf("Expected %v, but %v:", expected, goms)
 	}
 }
+
+func TestTomlGomfile(t *testing.T) {
+	f, err := ioutil.TempFile("", "gom*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+[[gom]]
+name = "github.com/mattn/go-sqlite3"
+tag = "3.14"
+commit = "asdfasdf"
+group = ["development", "test"]
+
+[[gom]]
+name = "github.com/mattn/go-ole"
+goos = ["windows"]
+private = true
+depth = 1
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms, err := parseGomfile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "3.14", "commit": "asdfasdf", "group": []string{"development", "test"}}},
+		{name: "github.com/mattn/go-ole", options: map[string]interface{}{"goos": []string{"windows"}, "private": "true", "depth": "1"}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileGroups(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-runewidth'
+group :development do
+	gom 'github.com/mattn/go-sqlite3'
+end
+group :test, :ci do
+	gom 'github.com/mattn/go-gtk'
+end
+gom 'github.com/mattn/go-ole', :group => [:production]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*groupsFlag, *withoutFlag = "", ""
+	}()
+
+	*developmentEnv = true
+	*groupsFlag = "ci,production"
+	goms, err := parseGomfile(filename)
+	*developmentEnv = false
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms = filterGoms(goms)
+	expected := []Gom{
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-ole", options: map[string]interface{}{"group": []string{"production"}}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+
+	*withoutFlag = "production"
+	goms, err = parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms = filterGoms(goms)
+	expected = expected[:2]
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileSyntaxError(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-runewidth'
+gom 'github.com/mattn/go-sqlite3', :tag => 3.14
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	_, err = parseGomfile(filename)
+	expected := &ParseError{Line: 3, Text: "gom 'github.com/mattn/go-sqlite3', :tag => 3.14"}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, err)
+	}
+
+	f, err := ioutil.TempFile("", "gom*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+[[gom]]
+name = "github.com/mattn/go-sqlite3"
+tag = 3.14.1
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parseGomfile(f.Name())
+	pe, ok := err.(*ParseError)
+	if !ok || pe.Line != 4 {
+		t.Fatalf("Expected a ParseError at line 4, but %v:", err)
+	}
+}
+
+func TestFilterPlatform(t *testing.T) {
+	otherOS, otherArch := "plan9", "mips"
+	if runtime.GOOS == otherOS {
+		otherOS = "windows"
+	}
+	if runtime.GOARCH == otherArch {
+		otherArch = "amd64"
+	}
+	goms := []Gom{
+		{name: "example.com/os", options: map[string]interface{}{"goos": runtime.GOOS}},
+		{name: "example.com/arch", options: map[string]interface{}{"goarch": []string{otherArch, runtime.GOARCH}}},
+		{name: "example.com/other-arch", options: map[string]interface{}{"goarch": otherArch}},
+		{name: "example.com/both", options: map[string]interface{}{"goos": runtime.GOOS, "goarch": runtime.GOARCH}},
+		{name: "example.com/other-os", options: map[string]interface{}{"goos": otherOS, "goarch": runtime.GOARCH}},
+	}
+	expected := []Gom{goms[0], goms[1], goms[3]}
+	if filtered := filterGoms(goms); !reflect.DeepEqual(filtered, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, filtered)
+	}
+}
+
+func TestOptionValues(t *testing.T) {
+	for _, c := range []struct {
+		option   interface{}
+		expected []string
+	}{
+		{"linux", []string{"linux"}},
+		{"darwin, linux", []string{"darwin", "linux"}},
+		{[]string{"darwin", "linux"}, []string{"darwin", "linux"}},
+		{nil, nil},
+	} {
+		if values := optionValues(c.option); !reflect.DeepEqual(values, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, values)
+		}
+	}
+
+	if !matchOS("plan9," + runtime.GOOS) {
+		t.Fatalf("Expected %v to match", runtime.GOOS)
+	}
+	defer func() { *groupsFlag = "" }()
+	*groupsFlag = "ci"
+	if !matchEnv("test,ci") {
+		t.Fatal("Expected group ci to match")
+	}
+}
+
+func TestNegatedGroups(t *testing.T) {
+	defer func(groups string) { *groupsFlag = groups }(*groupsFlag)
+	for _, c := range []struct {
+		groups   string
+		option   interface{}
+		expected bool
+	}{
+		{"development", "!production", true},
+		{"production", "!production", false},
+		{"test", []string{"test", "!production"}, true},
+		{"test,production", []string{"test", "!production"}, false},
+		{"development", []string{"test", "!production"}, false},
+		{"ci", "!production, !test", true},
+	} {
+		*groupsFlag = c.groups
+		if got := matchEnv(c.option); got != c.expected {
+			t.Fatalf("Expected %v, but %v: %v in %v", c.expected, got, c.option, c.groups)
+		}
+	}
+
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :group => [:test, :!production]
+group :!production do
+  gom 'github.com/mattn/go-runewidth'
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	*groupsFlag = "production"
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"group": []string{"test", "!production"}}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	filename, err := tempGomfile(`
+pre_install 'go generate ./...'
+ssh_hosts '*.internal.example.com, git.example.org'
+gom 'github.com/mattn/go-sqlite3'
+post_install "make assets"
+group :ci do
+  post_install 'make report'
+end
+post_install 'make lint'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	h, err := parseSettings(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := settings{
+		"pre_install":  {"go generate ./..."},
+		"post_install": {"make assets", "make lint"},
+		"ssh_hosts":    {"*.internal.example.com, git.example.org"},
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, h)
+	}
+	hosts := []string{"*.internal.example.com", "git.example.org"}
+	if !reflect.DeepEqual(h.sshHosts(), hosts) {
+		t.Fatalf("Expected %v, but %v:", hosts, h.sshHosts())
+	}
+
+	f, err := ioutil.TempFile("", "gom*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+pre_install = "go generate ./..."
+post_install = ["make assets", "make lint"]
+ssh_hosts = ["*.internal.example.com, git.example.org"]
+
+[[gom]]
+name = "github.com/mattn/go-sqlite3"
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err = parseSettings(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, h)
+	}
+
+	err = ioutil.WriteFile(f.Name(), []byte("post_install = [\"make assets\", 1]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = parseSettings(f.Name())
+	if err == nil || !strings.Contains(err.Error(), "post_install must be a string or a list of them") {
+		t.Fatalf("Expected %v, but %v:", "post_install must be a string or a list of them", err)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no true and false commands")
+	}
+	h := settings{"pre_install": {"true", "false", "no-such-command"}}
+	err := h.run("pre_install")
+	if err == nil || err.Error() != `pre_install hook "false" failed: exit status 1` {
+		t.Fatalf("Expected the false hook to fail, but %v:", err)
+	}
+	if err = h.run("post_install"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hooks run from the directory of the Gomfile, split like a shell does.
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(flag string) { *gomfileFlag = flag }(*gomfileFlag)
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	h = settings{"post_install": {`sh -c "pwd > 'out file'"`}}
+	if err = h.run("post_install"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "out file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if real, _ := filepath.EvalSymlinks(dir); strings.TrimSpace(string(b)) != real {
+		t.Fatalf("Expected %v, but %v:", real, strings.TrimSpace(string(b)))
+	}
+	h = settings{"post_install": {`echo "unterminated`}}
+	if err = h.run("post_install"); err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Fatalf("Expected an unterminated quote to fail, but %v:", err)
+	}
+}
+
+func TestNormalizeImportPath(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-sqlite3/", "github.com/mattn/go-sqlite3"},
+		{"GitHub.com/mattn/Go-SQLite3", "github.com/mattn/Go-SQLite3"},
+		{"github.com//mattn/go-sqlite3", "github.com/mattn/go-sqlite3"},
+		{"github.com/mattn/go-sqlite3", "github.com/mattn/go-sqlite3"},
+	} {
+		if name := normalizeImportPath(c.name); name != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, name)
+		}
+	}
+}
+
+func TestMergeGoms(t *testing.T) {
+	defer func(groups string) { *groupsFlag = groups }(*groupsFlag)
+	*groupsFlag = "development,test"
+
+	for _, c := range []struct {
+		gomfile  string
+		expected []Gom
+		err      string
+	}{
+		{
+			"gom 'github.com/mattn/go-sqlite3', :tag => 'v1'\ngom 'github.com/mattn/go-sqlite3/'\n",
+			[]Gom{{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "v1"}}},
+			"",
+		},
+		{
+			"gom 'github.com/mattn/go-sqlite3', :group => 'development'\ngom 'GitHub.com/mattn/go-sqlite3', :group => 'test'\n",
+			[]Gom{{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"group": []string{"development", "test"}}}},
+			"",
+		},
+		{
+			"gom 'github.com/mattn/go-sqlite3', :group => 'production', :tag => 'v2'\ngom 'github.com/mattn/go-sqlite3', :group => 'test', :tag => 'v1'\n",
+			[]Gom{{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"group": "test", "tag": "v1"}}},
+			"",
+		},
+		{
+			"gom 'github.com/mattn/go-sqlite3', :tag => 'v1'\ngom 'github.com/mattn/go-sqlite3', :tag => 'v2'\n",
+			nil,
+			"Syntax Error: github.com/mattn/go-sqlite3 is declared with conflicting versions tag v1 and tag v2",
+		},
+		{
+			"gom 'github.com/mattn/go-sqlite3', :tag => 'v1'\ngom 'github.com/mattn/go-sqlite3', :commit => 'ecb144fb1f28'\n",
+			nil,
+			"Syntax Error: github.com/mattn/go-sqlite3 is declared with conflicting versions tag v1 and commit ecb144fb1f28",
+		},
+		{
+			"gom 'github.com/mattn/go-sqlite3', :goos => 'linux'\ngom 'github.com/mattn/go-sqlite3', :goos => 'darwin'\n",
+			nil,
+			"Syntax Error: github.com/mattn/go-sqlite3 is declared with conflicting goos options linux and darwin",
+		},
+	} {
+		filename, err := tempGomfile(c.gomfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goms, err := parseGomfile(filename)
+		os.Remove(filename)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Fatalf("Expected %v, but %v:", c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(goms, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, goms)
+		}
+	}
+}
+
+func TestGomfileEnv(t *testing.T) {
+	defer os.Setenv("GOM_TEST_FETCHER", os.Getenv("GOM_TEST_FETCHER"))
+	defer os.Setenv("GOM_TEST_OWNER", os.Getenv("GOM_TEST_OWNER"))
+	os.Setenv("GOM_TEST_FETCHER", "/opt/fetch.sh")
+	os.Setenv("GOM_TEST_OWNER", "username")
+	os.Unsetenv("GOM_TEST_UNSET")
+
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-sqlite3', :command => '$GOM_TEST_FETCHER {{.Dir}}', :fork => 'github.com/${GOM_TEST_OWNER}/go-sqlite3'
+gom 'github.com/mattn/go-gtk', :goos => 'linux$GOM_TEST_UNSET'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	goms, err := parseGomfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"command": "/opt/fetch.sh {{.Dir}}", "fork": "github.com/username/go-sqlite3"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"goos": "linux"}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestGomfileFlag(t *testing.T) {
+	filename, err := tempGomfile(`
+gom 'github.com/mattn/go-runewidth', :tag => 'go1'
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	stdin, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	oldstdin := os.Stdin
+	oldflag := *gomfileFlag
+	defer func() {
+		os.Stdin = oldstdin
+		*gomfileFlag = oldflag
+		stdinOnce = sync.Once{}
+	}()
+	os.Stdin = stdin
+	*gomfileFlag = "-"
+
+	expected := []Gom{
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"tag": "go1"}},
+	}
+	// Stdin is read once, so parsing it again gives the same goms.
+	for i := 0; i < 2; i++ {
+		goms, err := parseGomfile(gomfilePath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(goms, expected) {
+			t.Fatalf("Expected %v, but %v:", expected, goms)
+		}
+	}
+	if lockfilePath() != "Gomfile.lock" {
+		t.Fatalf("Expected %v, but %v:", "Gomfile.lock", lockfilePath())
+	}
+
+	*gomfileFlag = "Gomfile.ci"
+	if gomfilePath() != "Gomfile.ci" {
+		t.Fatalf("Expected %v, but %v:", "Gomfile.ci", gomfilePath())
+	}
+	if lockfilePath() != "Gomfile.ci.lock" {
+		t.Fatalf("Expected %v, but %v:", "Gomfile.ci.lock", lockfilePath())
+	}
+	if sumfilePath() != "Gomfile.ci.sum" {
+		t.Fatalf("Expected %v, but %v:", "Gomfile.ci.sum", sumfilePath())
+	}
+}
+
+func TestGomfileInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "platform"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"platform/Base.gomfile": `
+pre_install 'go generate ./...'
+gom 'github.com/mattn/go-runewidth', :tag => 'v0.0.9'
+gom 'github.com/mattn/go-sqlite3', :tag => 'v1.10.0'
+`,
+		"Gomfile": `
+include 'platform/Base.gomfile'
+pre_install 'make assets'
+gom 'github.com/mattn/go-sqlite3', :tag => 'v1.14.0'
+gom 'github.com/mattn/go-colorable'
+`,
+		"Cycle.gomfile": `
+include 'Cycle.gomfile'
+`,
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goms, err := parseGomfile(filepath.Join(dir, "Gomfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Gom{
+		{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"tag": "v0.0.9"}},
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "v1.14.0"}},
+		{name: "github.com/mattn/go-colorable", options: map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+	h, err := parseSettings(filepath.Join(dir, "Gomfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks := settings{"pre_install": {"go generate ./...", "make assets"}}
+	if !reflect.DeepEqual(h, hooks) {
+		t.Fatalf("Expected %v, but %v:", hooks, h)
+	}
+
+	_, err = parseGomfile(filepath.Join(dir, "Cycle.gomfile"))
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a ParseError, but %v:", err)
+	}
+}
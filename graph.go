@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// importEdge is an import of the package to by the package from.
+type importEdge struct {
+	from string
+	to   string
+}
+
+// importGraph returns the packages of goms vendored in vendor, and the
+// imports of everything they import, transitively, up to depth imports
+// away from them unless depth is 0. Standard packages are left out.
+func importGraph(vendor string, goms []Gom, depth int) ([]string, []importEdge, error) {
+	src := filepath.Join(vendor, "src")
+	pkgs, err := gomPackages(src, goms)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots := make([]string, 0)
+	level := make(map[string]int)
+	for _, pkg := range pkgs {
+		if _, ok := level[pkg]; ok {
+			continue
+		}
+		// Leave out the directories holding no package, such as the root of
+		// a repository of several.
+		if hasGoFiles(filepath.Join(src, filepath.FromSlash(pkg))) {
+			roots = append(roots, pkg)
+			level[pkg] = 0
+		}
+	}
+	edges := make([]importEdge, 0)
+	seen := make(map[importEdge]bool)
+	queue := append([]string{}, roots...)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if depth > 0 && level[pkg] >= depth {
+			continue
+		}
+		imports, err := packageImports(filepath.Join(src, filepath.FromSlash(pkg)))
+		if err != nil {
+			// Not vendored, e.g. missing from the Gomfile.
+			continue
+		}
+		for _, imp := range imports {
+			if isStandardImport(imp) {
+				continue
+			}
+			if e := (importEdge{pkg, imp}); !seen[e] {
+				seen[e] = true
+				edges = append(edges, e)
+			}
+			if _, ok := level[imp]; !ok {
+				level[imp] = level[pkg] + 1
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return roots, edges, nil
+}
+
+// writeDot writes the import graph as Graphviz DOT, the packages of the
+// goms filled in.
+func writeDot(w io.Writer, roots []string, edges []importEdge) {
+	fmt.Fprintln(w, "digraph gom {")
+	for _, pkg := range roots {
+		fmt.Fprintf(w, "\t%q [style=filled, fillcolor=lightblue];\n", pkg)
+	}
+	for _, e := range edges {
+		fmt.Fprintf(w, "\t%q -> %q;\n", e.from, e.to)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// graph prints the graph of the imports of the vendored packages, from the
+// packages of the Gomfile, for dot to render.
+func graph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	depth := fs.Int("depth", 0, "only follow imports this far from the Gomfile packages, 0 for no limit")
+	fs.Parse(args)
+
+	goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	roots, edges, err := importGraph(vendor, goms, *depth)
+	if err != nil {
+		return err
+	}
+	writeDot(os.Stdout, roots, edges)
+	return nil
+}
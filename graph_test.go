@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportGraph(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"src/github.com/mattn/go-gtk/gtk/gtk.go": `package gtk
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-pointer"
+)
+`,
+		"src/github.com/mattn/go-pointer/pointer.go": `package pointer
+
+import "github.com/mattn/go-ole/oleutil"
+`,
+		"src/github.com/mattn/go-ole/oleutil/oleutil.go": "package oleutil\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goms := []Gom{{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}}
+	for _, c := range []struct {
+		depth    int
+		expected string
+	}{
+		{0, `digraph gom {
+	"github.com/mattn/go-gtk/gtk" [style=filled, fillcolor=lightblue];
+	"github.com/mattn/go-gtk/gtk" -> "github.com/mattn/go-pointer";
+	"github.com/mattn/go-pointer" -> "github.com/mattn/go-ole/oleutil";
+}
+`},
+		{1, `digraph gom {
+	"github.com/mattn/go-gtk/gtk" [style=filled, fillcolor=lightblue];
+	"github.com/mattn/go-gtk/gtk" -> "github.com/mattn/go-pointer";
+}
+`},
+	} {
+		roots, edges, err := importGraph(dir, goms, c.depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		writeDot(&buf, roots, edges)
+		if buf.String() != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, buf.String())
+		}
+	}
+}
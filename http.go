@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// httpDo sends the request method to u with body, of contentType unless it
+// is "", and returns the response if it is 200 OK, for the caller to read and close.
+// Like runRetry, it retries with exponential backoff, up to *retries times,
+// while the request fails to go through or the server fails with a 5xx or
+// 429 status, and gives up after -timeout each time. Its failures are
+// returned as a *FetchError.
+func httpDo(method, u, contentType string, body []byte) (*http.Response, error) {
+	args := []string{method, u}
+	client := &http.Client{Timeout: *timeout}
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		tracef("+ %s %s\n", method, redact(u))
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, &FetchError{args, err}
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := client.Do(req)
+		retry := err != nil
+		if err == nil {
+			if resp.StatusCode == http.StatusOK {
+				return resp, nil
+			}
+			resp.Body.Close()
+			err = fmt.Errorf("%s", resp.Status)
+			retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		}
+		if attempt >= *retries || !retry {
+			return nil, &FetchError{args, err}
+		}
+		progressf("retrying %s %s in %v\n", method, redact(u), delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// httpGet returns the body of u, fetched with httpDo.
+func httpGet(u string) ([]byte, error) {
+	resp, err := httpDo("GET", u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &FetchError{[]string{"GET", u}, err}
+	}
+	return body, nil
+}
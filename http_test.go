@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPGetRetries(t *testing.T) {
+	oldRetries, oldDelay := *retries, retryDelay
+	defer func() { *retries, retryDelay = oldRetries, oldDelay }()
+	*retries, retryDelay = 2, time.Millisecond
+
+	for _, c := range []struct {
+		failures int
+		status   int
+		requests int
+		ok       bool
+	}{
+		{0, http.StatusInternalServerError, 1, true},
+		{2, http.StatusServiceUnavailable, 3, true},
+		{2, http.StatusTooManyRequests, 3, true},
+		{3, http.StatusBadGateway, 3, false},
+		{1, http.StatusNotFound, 1, false},
+	} {
+		requests := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= c.failures {
+				w.WriteHeader(c.status)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		body, err := httpGet(ts.URL)
+		ts.Close()
+		if c.ok && (err != nil || string(body) != "ok") {
+			t.Fatalf("Expected %v, but %v:", "ok", []interface{}{string(body), err})
+		}
+		if !c.ok {
+			if _, isFetch := err.(*FetchError); !isFetch {
+				t.Fatalf("Expected %v, but %v:", "a FetchError", err)
+			}
+		}
+		if requests != c.requests {
+			t.Fatalf("Expected %v, but %v:", c.requests, requests)
+		}
+	}
+}
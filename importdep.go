@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// depProject is a [[constraint]] or [[override]] of Gopkg.toml, or one of
+// the [[projects]] of Gopkg.lock.
+type depProject struct {
+	Name     string      `toml:"name"`
+	Version  string      `toml:"version"`
+	Branch   string      `toml:"branch"`
+	Revision string      `toml:"revision"`
+	Source   string      `toml:"source"`
+	Metadata interface{} `toml:"metadata"`
+	// Only in Gopkg.lock, where they are dep's own bookkeeping.
+	Packages  []string `toml:"packages"`
+	PruneOpts string   `toml:"pruneopts"`
+	Digest    string   `toml:"digest"`
+}
+
+// re_depWildcard matches the wildcard versions of dep, like 1.2.x, which gom
+// constraints can't express.
+var re_depWildcard = regexp.MustCompile(`^[=~^<>!]*v?(\d+\.)*[xX*](\.[xX*])*$`)
+
+// re_hexRevision matches the revisions of git, or hg, repositories.
+var re_hexRevision = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// depVersion returns the tag option of a gom for the version of a dep
+// constraint, and false if gom can't express it. A bare semantic version
+// means ^version to dep, a version that isn't semantic is the name of a tag.
+func depVersion(v string) (string, bool) {
+	if strings.Contains(v, "||") {
+		return "", false
+	}
+	fields := strings.Fields(strings.Replace(v, ",", " ", -1))
+	for _, f := range fields {
+		if re_depWildcard.MatchString(f) {
+			return "", false
+		}
+	}
+	if len(fields) == 1 {
+		if _, ok := parseVersion(fields[0]); ok {
+			return "^" + fields[0], true
+		}
+	}
+	tag := strings.Join(fields, " ")
+	if tag == "" {
+		return "", false
+	}
+	if !isVersionConstraint(tag) {
+		return tag, len(fields) == 1
+	}
+	if _, err := parseConstraint(tag); err != nil {
+		return "", false
+	}
+	return tag, true
+}
+
+// decodeDepFile decodes the Gopkg.toml or Gopkg.lock filename into v.
+func decodeDepFile(filename string, v interface{}) (toml.MetaData, error) {
+	md, err := toml.DecodeFile(filename, v)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return md, err
+		}
+		return md, fmt.Errorf("can't read %s: %v", filename, err)
+	}
+	return md, nil
+}
+
+// importDep generates Gomfile and Gomfile.lock from Gopkg.toml and
+// Gopkg.lock of dep, in the directory given in args or the current one. The
+// constraints become the branch, tag or commit of their gom, the projects
+// dep locked are added too and their revisions go into Gomfile.lock. What
+// can't be translated is reported.
+func importDep(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: gom import-dep [directory]")
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	filename := "Gomfile"
+	if *gomfileFlag != "" {
+		filename = *gomfileFlag
+	}
+	if filename != stdinGomfile {
+		for _, f := range []string{filename, lockfilePath()} {
+			if _, err := os.Stat(f); err == nil {
+				return fmt.Errorf("%s already exists", f)
+			}
+		}
+	}
+
+	manifestPath := filepath.Join(dir, "Gopkg.toml")
+	var manifest struct {
+		Constraints []depProject           `toml:"constraint"`
+		Overrides   []depProject           `toml:"override"`
+		Required    []string               `toml:"required"`
+		Ignored     []string               `toml:"ignored"`
+		Prune       map[string]interface{} `toml:"prune"`
+		Metadata    interface{}            `toml:"metadata"`
+	}
+	md, err := decodeDepFile(manifestPath, &manifest)
+	if err != nil {
+		return err
+	}
+	for _, key := range md.Undecoded() {
+		warnf("%s in %s has no equivalent in gom, it is left out\n", key, manifestPath)
+	}
+	if manifest.Metadata != nil {
+		warnf("the metadata of %s is left out\n", manifestPath)
+	}
+	if len(manifest.Prune) > 0 {
+		warnf("the prune options of %s aren't kept, run gom prune instead\n", manifestPath)
+	}
+	for _, pkg := range manifest.Ignored {
+		warnf("%s is ignored in %s, which gom can't express: go get still fetches it if it is imported\n", pkg, manifestPath)
+	}
+
+	constraints := make(map[string]depProject)
+	for _, c := range manifest.Constraints {
+		constraints[c.Name] = c
+	}
+	// An override is the version of the project for the whole tree, which
+	// the Gomfile of the project gives already.
+	for _, o := range manifest.Overrides {
+		if _, ok := constraints[o.Name]; ok {
+			warnf("the override of %s replaces its constraint\n", o.Name)
+		}
+		constraints[o.Name] = o
+	}
+
+	lockPath := filepath.Join(dir, "Gopkg.lock")
+	var lockFile struct {
+		Projects []depProject `toml:"projects"`
+	}
+	hasLock := isFile(lockPath)
+	if hasLock {
+		_, err = decodeDepFile(lockPath, &lockFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		warnf("there is no %s, only the constraints of %s are imported\n", lockPath, manifestPath)
+	}
+	locked := make(map[string]depProject)
+	for _, p := range lockFile.Projects {
+		locked[p.Name] = p
+	}
+	for _, pkg := range manifest.Required {
+		found := false
+		for name := range locked {
+			if pkg == name || strings.HasPrefix(pkg, name+"/") {
+				found = true
+			}
+		}
+		if !found {
+			warnf("%s is required in %s but not locked, it is left out\n", pkg, manifestPath)
+		}
+	}
+
+	names := make([]string, 0, len(constraints)+len(locked))
+	for name := range locked {
+		names = append(names, name)
+	}
+	for name := range constraints {
+		if _, ok := locked[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	entries := make(map[string][]option, len(names))
+	locks := make([]lock, 0, len(locked))
+	for _, name := range names {
+		c, direct := constraints[name]
+		l, isLocked := locked[name]
+		opts := make([]option, 0)
+		switch {
+		case direct && c.Revision != "":
+			opts = append(opts, option{"commit", c.Revision})
+		case direct && c.Branch != "":
+			opts = append(opts, option{"branch", c.Branch})
+		case direct && c.Version != "":
+			if tag, ok := depVersion(c.Version); ok {
+				opts = append(opts, option{"tag", tag})
+			} else if isLocked && l.Version != "" {
+				warnf("gom can't express the version %q of %s, it is pinned to %s as locked\n", c.Version, name, l.Version)
+				opts = append(opts, option{"tag", l.Version})
+			} else {
+				warnf("gom can't express the version %q of %s, it is left out\n", c.Version, name)
+			}
+		case isLocked && l.Version != "":
+			opts = append(opts, option{"tag", l.Version})
+		case isLocked && l.Branch != "":
+			opts = append(opts, option{"branch", l.Branch})
+		}
+		source := l.Source
+		if direct && c.Source != "" {
+			source = c.Source
+		}
+		if source != "" {
+			opts = append(opts, option{"replace", source})
+		}
+		if direct && c.Metadata != nil {
+			warnf("the metadata of %s is left out\n", name)
+		}
+		entries[name] = opts
+
+		if !isLocked {
+			if hasLock {
+				warnf("%s isn't in %s, so it isn't locked\n", name, lockPath)
+			}
+			continue
+		}
+		vcs := guessVCS(name)
+		if source != "" {
+			vcs = guessVCS(strings.TrimPrefix(strings.TrimPrefix(source, "https://"), "http://"))
+		}
+		if vcs == "" && re_hexRevision.MatchString(l.Revision) {
+			vcs = "git"
+		}
+		if vcs == "" {
+			warnf("can't tell the VCS of %s at %s, it isn't locked\n", name, l.Revision)
+			continue
+		}
+		pinned := &Gom{name: name, options: map[string]interface{}{}}
+		for _, o := range opts {
+			pinned.options[o.key] = o.value
+		}
+		locks = append(locks, lock{name, vcs, l.Revision, gomPin(pinned)})
+	}
+
+	if *dryRun {
+		fmt.Printf("would write %d packages into %s\n", len(names), filename)
+		if hasLock && filename != stdinGomfile {
+			fmt.Printf("would write %d locks into %s\n", len(locks), lockfilePath())
+		}
+		return nil
+	}
+	if filename == stdinGomfile {
+		writeDepGomfile(os.Stdout, filename, names, entries)
+		return nil
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	// Buffered, so that a failed write is reported by Flush.
+	bw := bufio.NewWriter(f)
+	writeDepGomfile(bw, filename, names, entries)
+	err = bw.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if !hasLock {
+		return nil
+	}
+	return writeLockfile(lockfilePath(), locks)
+}
+
+// writeDepGomfile writes the entries of the goms names into w, in TOML if
+// filename is a Gomfile.toml.
+func writeDepGomfile(w io.Writer, filename string, names []string, entries map[string][]option) {
+	for _, name := range names {
+		if strings.HasSuffix(filename, ".toml") {
+			fmt.Fprintf(w, "[[gom]]\nname = %s\n", formatTomlValue(name))
+			for _, o := range entries[name] {
+				fmt.Fprintf(w, "%s = %s\n", o.key, formatTomlValue(o.value))
+			}
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprintln(w, formatGomfileLine("", name, entries[name]))
+		}
+	}
+}
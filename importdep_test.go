@@ -0,0 +1,168 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDepVersion(t *testing.T) {
+	for _, c := range []struct {
+		version string
+		tag     string
+		ok      bool
+	}{
+		{"1.2.0", "^1.2.0", true},
+		{"v1.2.0", "^v1.2.0", true},
+		{"=1.2.0", "=1.2.0", true},
+		{"~1.2.0", "~1.2.0", true},
+		{">=1.0.0, <2.0.0", ">=1.0.0 <2.0.0", true},
+		{"go1", "go1", true},
+		{"1.2.x", "", false},
+		{"^1.0.0 || ^2.0.0", "", false},
+	} {
+		tag, ok := depVersion(c.version)
+		if tag != c.tag || ok != c.ok {
+			t.Fatalf("Expected %v, but %v:", []interface{}{c.tag, c.ok}, []interface{}{tag, ok})
+		}
+	}
+}
+
+func TestImportDep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldGomfile := *gomfileFlag
+	defer func() { *gomfileFlag = oldGomfile }()
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "Gopkg.toml"), []byte(`
+ignored = ["github.com/username/ignored"]
+
+[[constraint]]
+  name = "github.com/mattn/go-sqlite3"
+  version = "1.14.0"
+
+[[constraint]]
+  name = "github.com/mattn/go-runewidth"
+  branch = "master"
+  source = "github.com/username/go-runewidth"
+
+[[override]]
+  name = "golang.org/x/sys"
+  revision = "0123456789abcdef0123456789abcdef01234567"
+
+[prune]
+  go-tests = true
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "Gopkg.lock"), []byte(`
+[[projects]]
+  digest = "1:abc"
+  name = "github.com/mattn/go-runewidth"
+  packages = ["."]
+  revision = "703b5e6b11ae25aeb2af9ebb5d5fdf8fa2575211"
+  branch = "master"
+  source = "github.com/username/go-runewidth"
+
+[[projects]]
+  name = "github.com/mattn/go-sqlite3"
+  packages = ["."]
+  revision = "8897bf145272af4dd0305518cfb725a5b6d0541c"
+  version = "v1.14.0"
+
+[[projects]]
+  name = "github.com/pkg/errors"
+  packages = ["."]
+  revision = "ba968bfe8b2f7e042a574c888954fccecfa385b4"
+  version = "v0.8.1"
+
+[[projects]]
+  name = "golang.org/x/sys"
+  packages = ["unix"]
+  revision = "0123456789abcdef0123456789abcdef01234567"
+
+[solve-meta]
+  input-imports = []
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importDep([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(*gomfileFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `gom 'github.com/mattn/go-runewidth', :branch => 'master', :replace => 'github.com/username/go-runewidth'
+gom 'github.com/mattn/go-sqlite3', :tag => '^1.14.0'
+gom 'github.com/pkg/errors', :tag => 'v0.8.1'
+gom 'golang.org/x/sys', :commit => '0123456789abcdef0123456789abcdef01234567'
+`
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+	b, err = ioutil.ReadFile(lockfilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `# Generated by gom lock. Do not edit.
+github.com/mattn/go-runewidth git 703b5e6b11ae25aeb2af9ebb5d5fdf8fa2575211 branch=master
+github.com/mattn/go-sqlite3 git 8897bf145272af4dd0305518cfb725a5b6d0541c tag=%5E1.14.0
+github.com/pkg/errors git ba968bfe8b2f7e042a574c888954fccecfa385b4 tag=v0.8.1
+golang.org/x/sys git 0123456789abcdef0123456789abcdef01234567 commit=0123456789abcdef0123456789abcdef01234567
+`
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+
+	// The Gomfile it wrote isn't overwritten.
+	err = importDep([]string{dir})
+	if err == nil {
+		t.Fatal("Expected an existing Gomfile to be an error")
+	}
+
+	// Gomfile.toml gets the same entries as [[gom]] tables.
+	*gomfileFlag = filepath.Join(dir, "Gomfile.toml")
+	err = importDep([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadFile(*gomfileFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `[[gom]]
+name = "github.com/mattn/go-runewidth"
+branch = "master"
+replace = "github.com/username/go-runewidth"
+
+[[gom]]
+name = "github.com/mattn/go-sqlite3"
+tag = "^1.14.0"
+
+[[gom]]
+name = "github.com/pkg/errors"
+tag = "v0.8.1"
+
+[[gom]]
+name = "golang.org/x/sys"
+commit = "0123456789abcdef0123456789abcdef01234567"
+
+`
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+	goms, err := parseGomfile(*gomfileFlag)
+	if err != nil || len(goms) != 4 {
+		t.Fatalf("Expected %v, but %v:", 4, []interface{}{goms, err})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// packageImports returns the import paths used by the .go files in dir.
+// Build constraints are ignored, so the imports of every platform are
+// included.
+func packageImports(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	imports := make([]string, 0)
+	fset := token.NewFileSet()
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, fi.Name()), nil, parser.ImportsOnly)
+		if err != nil {
+			// Broken files don't build, so they can't import anything.
+			continue
+		}
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			imports = appendPkg(imports, imp)
+		}
+	}
+	return imports, nil
+}
+
+// packageDirs returns the directories below root that may hold packages,
+// skipping the ones the go tool ignores.
+func packageDirs(root string) ([]string, error) {
+	dirs := make([]string, 0)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, p)
+		return nil
+	})
+	return dirs, err
+}
+
+// repoOf returns the element of repos holding the package path, or "".
+func repoOf(repos []string, path string) string {
+	for _, repo := range repos {
+		if path == repo || strings.HasPrefix(path, repo+"/") {
+			return repo
+		}
+	}
+	return ""
+}
+
+// gomPackages returns the import paths of the packages of goms vendored in
+// src, each once, though a gom's target is usually its name.
+func gomPackages(src string, goms []Gom) ([]string, error) {
+	pkgs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, gom := range goms {
+		for _, name := range []string{gom.name, getTarget(&gom)} {
+			root := filepath.Join(src, filepath.FromSlash(name))
+			if seen[root] || !isDir(root) {
+				continue
+			}
+			seen[root] = true
+			dirs, err := packageDirs(root)
+			if err != nil {
+				return nil, err
+			}
+			for _, dir := range dirs {
+				rel, err := filepath.Rel(src, dir)
+				if err != nil {
+					return nil, err
+				}
+				pkgs = append(pkgs, filepath.ToSlash(rel))
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// referencedRepos returns the vendored repos holding the code of goms and
+// of everything it imports, transitively.
+func referencedRepos(vendor string, goms []Gom, repos []string) (map[string]bool, error) {
+	src := filepath.Join(vendor, "src")
+	referenced := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	queue, err := gomPackages(src, goms)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		if visited[path] {
+			continue
+		}
+		visited[path] = true
+		repo := repoOf(repos, path)
+		if repo == "" {
+			// Not vendored, e.g. a standard package.
+			continue
+		}
+		referenced[repo] = true
+		imports, err := packageImports(filepath.Join(src, filepath.FromSlash(path)))
+		if err != nil {
+			continue
+		}
+		for _, imp := range imports {
+			if !isStandardImport(imp) {
+				queue = append(queue, imp)
+			}
+		}
+	}
+
+	// A gom may live inside a larger repo, or hold several repos.
+	for _, repo := range repos {
+		if declares(goms, repo) {
+			referenced[repo] = true
+		}
+	}
+	return referenced, nil
+}
@@ -1,34 +1,134 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
 type vcsCmd struct {
-	checkout []string
-	update   []string
+	name        string
+	checkout    []string
+	update      []string
+	revision    []string
+	fastForward []string
+	tags        []string
+	// parseRevision returns the revision in the output of revision, for the
+	// VCSs printing more than that.
+	parseRevision func(out string) string
+	// resolve prints the hash of the revision appended to it, and
+	// remoteBranch formats the revision of the fetched head of a branch.
+	// They are only set for VCSs whose update leaves the working tree alone.
+	resolve      []string
+	remoteBranch string
+	// remote prints the URL the repository was cloned from.
+	remote []string
+	// create clones the repository at the URL appended to it into the
+	// directory appended after that.
+	create []string
+	// status prints a line for each file changed in the working tree.
+	status []string
 }
 
 var (
 	hg = &vcsCmd{
-		[]string{"hg", "update"},
-		[]string{"hg", "pull"},
+		name:         "hg",
+		checkout:     []string{"hg", "update", "-r"},
+		update:       []string{"hg", "pull"},
+		revision:     []string{"hg", "log", "-r", ".", "--template", "{node}"},
+		fastForward:  []string{"hg", "update"},
+		tags:         []string{"hg", "tags", "-q"},
+		resolve:      []string{"hg", "log", "--template", "{node}", "-r"},
+		remoteBranch: "%s",
+		remote:       []string{"hg", "paths", "default"},
+		create:       []string{"hg", "clone", "-q"},
+		status:       []string{"hg", "status"},
 	}
 	git = &vcsCmd{
-		[]string{"git", "checkout", "-q"},
-		[]string{"git", "fetch"},
+		name:         "git",
+		checkout:     []string{"git", "checkout", "-q"},
+		update:       []string{"git", "fetch"},
+		revision:     []string{"git", "rev-parse", "HEAD"},
+		fastForward:  []string{"git", "merge", "-q", "--ff-only", "@{upstream}"},
+		tags:         []string{"git", "tag", "-l"},
+		resolve:      []string{"git", "log", "-1", "--format=%H"},
+		remoteBranch: "refs/remotes/origin/%s",
+		remote:       []string{"git", "config", "--get", "remote.origin.url"},
+		create:       []string{"git", "clone", "-q"},
+		// Without optional locks, git status doesn't write the stat
+		// information it refreshes back into the index.
+		status: []string{"git", "--no-optional-locks", "status", "--porcelain"},
 	}
 	bzr = &vcsCmd{
-		[]string{"bzr", "revert", "-r"},
-		[]string{"bzr", "pull"},
+		name:     "bzr",
+		checkout: []string{"bzr", "revert", "-r"},
+		update:   []string{"bzr", "pull"},
+		revision: []string{"bzr", "revno"},
+		tags:     []string{"bzr", "tags"},
+		create:   []string{"bzr", "branch"},
+		status:   []string{"bzr", "status", "--short"},
+	}
+	svn = &vcsCmd{
+		name:     "svn",
+		checkout: []string{"svn", "update", "-r"},
+		update:   []string{"svn", "update"},
+		revision: []string{"svn", "info", "--show-item", "revision"},
+		remote:   []string{"svn", "info", "--show-item", "url"},
+		create:   []string{"svn", "checkout", "-q"},
+		status:   []string{"svn", "status"},
+	}
+	fossil = &vcsCmd{
+		name:          "fossil",
+		checkout:      []string{"fossil", "update"},
+		update:        []string{"fossil", "pull"},
+		revision:      []string{"fossil", "info"},
+		parseRevision: fossilRevision,
+		fastForward:   []string{"fossil", "update"},
+		tags:          []string{"fossil", "tag", "list"},
+		status:        []string{"fossil", "changes"},
 	}
 )
 
+// fossilRevision returns the hash of the checkout line of fossil info, as
+// in "checkout:     5b3cf1a6c2... 2024-01-02 03:04:05 UTC", or "".
+func fossilRevision(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "checkout:" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// vcsMarker is a file or directory whose presence in a repository root
+// identifies the version control system managing it.
+type vcsMarker struct {
+	name string
+	dir  bool
+	vcs  *vcsCmd
+}
+
+var vcsMarkers = []vcsMarker{
+	{".git", true, git},
+	{".hg", true, hg},
+	{".bzr", true, bzr},
+	{".svn", true, svn},
+	{".fslckout", false, fossil},
+	{"_FOSSIL_", false, fossil},
+}
+
 var (
 	boolString = map[string]bool{
 		"t":     true,
@@ -46,50 +146,252 @@ var (
 	}
 )
 
+// detectVCS returns the vcsCmd managing the repository rooted at p, or nil.
+func detectVCS(p string) *vcsCmd {
+	for _, m := range vcsMarkers {
+		marker := filepath.Join(p, m.name)
+		if (m.dir && isDir(marker)) || (!m.dir && isFile(marker)) {
+			return m.vcs
+		}
+	}
+	return nil
+}
+
 func (vcs *vcsCmd) Checkout(p, destination string) error {
 	args := append(vcs.checkout, destination)
-	return vcsExec(p, args...)
+	return vcsExec(p, Cyan, args...)
 }
 
+// Update fetches the new revisions of the repository in p, unless -offline
+// forbids it.
 func (vcs *vcsCmd) Update(p string) error {
-	return vcsExec(p, vcs.update...)
+	if *offline {
+		return nil
+	}
+	args := withGitJobs(vcs.update)
+	err := vcsExec(p, Blue, args...)
+	if _, ok := err.(*exec.ExitError); ok {
+		// Timeouts and interruptions name the command already.
+		return &FetchError{args, err}
+	}
+	return err
+}
+
+// FastForward moves the working tree in p to the latest fetched revision of
+// the branch it is on. Version control systems whose update already does so
+// have nothing to do.
+func (vcs *vcsCmd) FastForward(p string) error {
+	if vcs.fastForward == nil {
+		return nil
+	}
+	return vcsExec(p, Blue, vcs.fastForward...)
+}
+
+// Revision returns the revision currently checked out in p.
+func (vcs *vcsCmd) Revision(p string) (string, error) {
+	if vcs.revision == nil {
+		return "", fmt.Errorf("gom can't determine the revision of %s repositories", vcs.name)
+	}
+	out, err := vcsOutput(p, vcs.revision...)
+	if err != nil {
+		return "", err
+	}
+	if vcs.parseRevision != nil {
+		if rev := vcs.parseRevision(out); rev != "" {
+			return rev, nil
+		}
+		return "", fmt.Errorf("can't find the revision of %s in the output of %s", p, strings.Join(vcs.revision, " "))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Resolve returns the hash of rev in the repository in p.
+func (vcs *vcsCmd) Resolve(p, rev string) (string, error) {
+	if vcs.resolve == nil {
+		return "", fmt.Errorf("gom can't resolve revisions of %s repositories", vcs.name)
+	}
+	out, err := vcsOutput(p, append(vcs.resolve, rev)...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Remote returns the URL the repository in p was cloned from.
+func (vcs *vcsCmd) Remote(p string) (string, error) {
+	if vcs.remote == nil {
+		return "", fmt.Errorf("gom can't tell where %s repositories come from", vcs.name)
+	}
+	out, err := vcsOutput(p, vcs.remote...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Changes returns the files changed in the working tree in p, as the
+// status command of the VCS lists them.
+func (vcs *vcsCmd) Changes(p string) ([]string, error) {
+	if vcs.status == nil {
+		return nil, fmt.Errorf("gom can't list the changes of %s repositories", vcs.name)
+	}
+	out, err := vcsOutput(p, vcs.status...)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) != "" {
+			changes = append(changes, line)
+		}
+	}
+	return changes, nil
+}
+
+// Tags returns the names of the tags of the repository in p.
+func (vcs *vcsCmd) Tags(p string) ([]string, error) {
+	if vcs.tags == nil {
+		return nil, fmt.Errorf("gom can't list the tags of %s repositories", vcs.name)
+	}
+	out, err := vcsOutput(p, vcs.tags...)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		// bzr prints the revision after the name of each tag.
+		if fields := strings.Fields(line); len(fields) > 0 {
+			tags = append(tags, fields[0])
+		}
+	}
+	return tags, nil
+}
+
+// ResolveTag returns the highest tag of the repository in p satisfying
+// constraint, fetching new tags if none of the known ones do.
+func (vcs *vcsCmd) ResolveTag(p, constraint string) (string, error) {
+	tags, err := vcs.Tags(p)
+	if err != nil {
+		return "", err
+	}
+	tag, err := highestTag(tags, constraint)
+	if err == nil {
+		return tag, nil
+	}
+	err = vcs.Update(p)
+	if err != nil {
+		return "", err
+	}
+	tags, err = vcs.Tags(p)
+	if err != nil {
+		return "", err
+	}
+	return highestTag(tags, constraint)
 }
 
 func (vcs *vcsCmd) Sync(p, destination string) error {
 	err := vcs.Checkout(p, destination)
+	if err != nil && *offline {
+		return fmt.Errorf("%s isn't in %s, and -offline forbids fetching it: %v", destination, p, err)
+	}
 	if err != nil {
 		err = vcs.Update(p)
 		if err != nil {
 			return err
 		}
 		err = vcs.Checkout(p, destination)
+		if err != nil && vcs == git && isShallow(p) {
+			// The revision is older than the shallow history, fetch the rest.
+			err = vcsExec(p, Blue, withGitJobs([]string{"git", "fetch", "-q", "--unshallow", "--tags"})...)
+			if err != nil {
+				return err
+			}
+			err = vcs.Checkout(p, destination)
+		}
 	}
 	return err
 }
 
-func vcsExec(dir string, args ...string) error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
+// hgRevset returns the mercurial revset of the revision given by the branch,
+// tag or commit option key. A name on its own is looked up as a bookmark, a
+// tag, a branch and a revision number in turn, so a tag could land on a
+// branch of the same name. A branch can also be a bookmark.
+func hgRevset(key, name string, bookmark bool) string {
+	quoted := hgLiteral(name)
+	switch {
+	case key == "tag":
+		return "tag(" + quoted + ")"
+	case key == "branch" && bookmark:
+		return "bookmark(" + quoted + ")"
+	case key == "branch":
+		// The tipmost head of the branch, where hg update would go.
+		return "max(branch(" + quoted + "))"
 	}
-	err = os.Chdir(dir)
-	if err != nil {
-		return err
-	}
-	defer os.Chdir(cwd)
-	cmd := exec.Command(args[0], args[1:]...)
-	cmd.Stdout = os.Stdout
+	return name
+}
+
+// hgLiteral quotes name as a revset string matched as it is, not as a pattern.
+func hgLiteral(name string) string {
+	return `"literal:` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// hgBookmark returns true if name is a bookmark of the repository in p.
+func hgBookmark(p, name string) bool {
+	out, err := vcsOutput(p, "hg", "log", "-r", "present(bookmark("+hgLiteral(name)+"))", "--template", "{node}")
+	return err == nil && strings.TrimSpace(out) != ""
+}
+
+// isShallow returns true if p is inside a shallow git clone.
+func isShallow(p string) bool {
+	cmd := exec.Command("git", "rev-parse", "--is-shallow-repository")
+	cmd.Dir = p
+	out, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
+
+// vcsOutput runs a command in dir and returns its standard output. Like
+// vcsExec, it is killed after -timeout.
+func vcsOutput(dir string, args ...string) (string, error) {
+	tracef("+ cd %s\n+ %s\n", dir, strings.Join(args, " "))
+	cmd, done := timedCommand(*timeout, dir, args)
 	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	out, err := cmd.Output()
+	return string(out), done(err)
+}
+
+func vcsExec(dir string, c Color, args ...string) error {
+	if *dryRun {
+		fmt.Fprintf(stdout, "would run in %s: %s\n", dir, strings.Join(args, " "))
+		return nil
+	}
+	tracef("+ cd %s\n+ %s\n", dir, strings.Join(args, " "))
+	// The command is started in dir, the working directory of gom is left
+	// alone for the commands running alongside.
+	cmd, done := timedCommand(*timeout, dir, args)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if parallel {
+		var outBuf, errBuf bytes.Buffer
+		cmd.Stdout = &outBuf
+		cmd.Stderr = &errBuf
+		err := cmd.Run()
+		flushOutput(c, outBuf.String(), errBuf.String())
+		return done(err)
+	}
+	changeColor(c)
+	err := cmd.Run()
+	resetColor()
+	return done(err)
 }
 
+// has returns true if c, options or a list of strings, has key.
 func has(c interface{}, key string) bool {
 	if m, ok := c.(map[string]interface{}); ok {
 		_, ok := m[key]
 		return ok
 	} else if a, ok := c.([]string); ok {
 		for _, s := range a {
-			if ok && s == key {
+			if s == key {
 				return true
 			}
 		}
@@ -97,66 +399,234 @@ func has(c interface{}, key string) bool {
 	return false
 }
 
-func (gom *Gom) Clone(args []string) error {
+// commandData holds the placeholders that can be used in the command
+// option of a gom:
+//
+//	{{.Dir}}   the directory the gom must be fetched into
+//	{{.Name}}  the import path the gom is fetched from
+//
+// The command runs in the parent directory of {{.Dir}}.
+type commandData struct {
+	Dir  string
+	Name string
+}
+
+// expandCommand splits command into arguments and expands the placeholders
+// of data in each. A command without placeholders gets the directory
+// appended, as was done before placeholders were supported.
+func expandCommand(command string, data commandData) ([]string, error) {
+	args := strings.Fields(command)
+	if !strings.Contains(command, "{{") {
+		return append(args, data.Dir), nil
+	}
+	for i, arg := range args {
+		t, err := template.New("command").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = t.Execute(&buf, data)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = buf.String()
+	}
+	return args, nil
+}
+
+// localPath returns the path option of gom, the local directory it is
+// developed in.
+func (gom *Gom) localPath() (string, bool) {
+	local, ok := gom.options["path"].(string)
+	return local, ok && local != ""
+}
+
+// linkLocal links the vendor directory of gom to the local directory
+// local, replacing the link of an earlier install.
+func (gom *Gom) linkLocal(vendor, local string) error {
+	src, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+	if !isDir(src) {
+		return fmt.Errorf("%s: %s is not a directory", gom.name, local)
+	}
+	dst := gom.dir(vendor)
+	if *dryRun {
+		fmt.Fprintf(stdout, "would link %s to %s\n", dst, src)
+		return nil
+	}
+	if fi, err := os.Lstat(dst); err == nil {
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%s: %s is in the way of the link to %s, remove it first", gom.name, dst, local)
+		}
+		err = os.Remove(dst)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	progressf("linking %s to %s\n", gom.name, local)
+	return os.Symlink(src, dst)
+}
+
+// forkInstalled returns true if the target directory of a gom with the fork
+// option already holds a clone of the fork at the revision the gom is
+// pinned to, leaving nothing to fetch nor copy.
+func (gom *Gom) forkInstalled(vendor string) bool {
+	dst := filepath.Join(vendor, "src", repoPath(getTarget(gom)))
+	vcs := detectVCS(dst)
+	if vcs == nil || vcs.remote == nil {
+		return false
+	}
+	remote, err := vcs.Remote(dst)
+	if err != nil || remoteRepo(remote) != repoPath(getFork(gom)) {
+		return false
+	}
+	rev := gom.version()
+	if rev == "" || isVersionConstraint(rev) {
+		// Checkout resolves constraints against the tags of the clone.
+		return true
+	}
+	return atRevision(dst, vcs, rev)
+}
+
+// remoteRepo returns the host and path of the repository at the remote URL,
+// like github.com/mattn/gom, or "" if it has none. The scp-like syntax of
+// SSH remotes, git@github.com:mattn/gom.git, is understood too.
+func remoteRepo(remote string) string {
+	if !strings.Contains(remote, "://") {
+		i := strings.Index(remote, ":")
+		if i < 0 || strings.Contains(remote[:i], "/") {
+			return ""
+		}
+		remote = "ssh://" + remote[:i] + "/" + strings.TrimPrefix(remote[i+1:], "/")
+	}
+	u, err := url.Parse(remote)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if p == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname()) + "/" + p
+}
+
+// atRevision returns true if the repository p is checked out at rev.
+func atRevision(p string, vcs *vcsCmd, rev string) bool {
+	wanted, err := vcs.Resolve(p, rev)
+	if err != nil {
+		return false
+	}
+	current, err := vcs.Revision(p)
+	return err == nil && current == wanted
+}
+
+// upToDate returns true if gom is already checked out at the commit or tag
+// it is pinned to, which can't move, leaving nothing to fetch. -force makes
+// everything be fetched again. Forks and replacements are looked after by
+// Clone itself.
+func (gom *Gom) upToDate(vendor string) bool {
+	if *force || has(gom.options, "fork") || has(gom.options, "replace") {
+		return false
+	}
+	keys := versionOptions(gom)
+	if len(keys) != 1 || (keys[0] != "commit" && keys[0] != "tag") || isVersionConstraint(gom.version()) {
+		return false
+	}
+	vcs := gom.vcs(vendor)
+	return vcs != nil && atRevision(gom.dir(vendor), vcs, gom.version())
+}
+
+func (gom *Gom) Clone(args []string) (err error) {
+	defer reportStep("clone", gom.name, time.Now(), &err)
 	vendor, err := filepath.Abs(vendorFolder)
 	if err != nil {
 		return err
 	}
+	if local, ok := gom.localPath(); ok {
+		return gom.linkLocal(vendor, local)
+	}
+	for _, name := range []string{getTarget(gom), getFork(gom)} {
+		complete := creating(fetchDir(vendor, name))
+		defer func() {
+			if err == nil {
+				complete()
+			}
+		}()
+	}
+	if *offline {
+		return gom.cloneOffline(vendor)
+	}
+	if gom.isRelease() {
+		return gom.fetchRelease(vendor)
+	}
+	if gom.upToDate(vendor) {
+		progressf("%s is already at %s\n", gom.name, gom.version())
+		return nil
+	}
+	if has(gom.options, "replace") {
+		if has(gom.options, "fork") {
+			return fmt.Errorf("%s has conflicting options fork, replace, give only one of them", gom.name)
+		}
+		err = gom.cloneReplace(vendor)
+		if err != nil {
+			return err
+		}
+		// The clone is in place, go get only fetches its dependencies.
+		progressf("downloading the dependencies of %s\n", gom.name)
+		return runRetry("", append(append([]string{goCommand(), "get", "-d"}, args...), gom.name), Blue)
+	}
+	if has(gom.options, "fork") && gom.forkInstalled(vendor) {
+		progressf("%s already holds %s\n", getTarget(gom), getFork(gom))
+		return nil
+	}
 	name := getFork(gom)
-	if command, ok := gom.options["command"].(string); ok {
+	cached := gom.restoreFromCache(vendor, name)
+	if command, ok := gom.options["command"].(string); ok && !cached {
 		srcdir := filepath.Join(vendor, "src", name)
-		customCmd := strings.Split(command, " ")
-		customCmd = append(customCmd, srcdir)
+		customCmd, err := expandCommand(command, commandData{srcdir, name})
+		if err != nil {
+			return err
+		}
+		parent := filepath.Dir(srcdir)
+		if !*dryRun {
+			err = os.MkdirAll(parent, 0755)
+			if err != nil {
+				return err
+			}
+		}
 
-		fmt.Printf("fetching %s (%v)\n", name, customCmd)
-		err = run(customCmd, Blue)
+		progressf("fetching %s (%v)\n", name, customCmd)
+		err = runRetry(parent, customCmd, Blue)
 		if err != nil {
 			return err
 		}
-	} else if private, ok := gom.options["private"].(string); ok {
+	} else if private, ok := gom.options["private"].(string); ok && !cached {
 		if boolString[strings.ToLower(private)] {
-			srcdir := filepath.Join(vendor, "src", name)
-			if _, err := os.Stat(srcdir); err != nil {
-				if os.IsExist(err) {
-					fmt.Printf("pulling private %s\n", name)
-					if err := gom.pullPrivate(srcdir); err != nil {
-						return err
-					}
-				} else {
-					useHttps := false
-					if possible, ok := gom.options["https"].(string); ok {
-						useHttps = boolString[strings.ToLower(possible)]
-					}
-					fmt.Printf("cloning private %s\n", name)
-					if err := gom.clonePrivate(srcdir, useHttps); err != nil {
-						return err
-					}
-				}
+			if err := gom.fetchPrivate(filepath.Join(vendor, "src", repoPath(name)), name); err != nil {
+				return err
 			}
 		}
 	}
 
-	cmdArgs := []string{"go", "get", "-d"}
+	cmdArgs := []string{goCommand(), "get", "-d"}
 	cmdArgs = append(cmdArgs, args...)
 	cmdArgs = append(cmdArgs, name)
 
-	fmt.Printf("downloading %s\n", name)
-	result := run(cmdArgs, Blue)
+	progressf("downloading %s\n", name)
+	result := runRetry("", cmdArgs, Blue)
+	if result == nil && !cached {
+		gom.saveToCache(vendor, name)
+	}
 
 	// We're going to use a fork
 	if has(gom.options, "fork") {
-		// we now need to move from fork to target
-		var (
-			tag = getTarget(gom)
-			src = filepath.Join(vendor, "src", getFork(gom))
-			dst = filepath.Join(vendor, "src", tag)
-		)
-		fmt.Printf("forking (%s, %s)\n", name, tag)
-
-		if err := mustCopyDir(dst, src); err != nil {
-			return err
-		}
-		if err := os.RemoveAll(src); err != nil {
+		if err := gom.moveFork(vendor); err != nil {
 			return err
 		}
 	}
@@ -164,31 +634,68 @@ func (gom *Gom) Clone(args []string) error {
 	return result
 }
 
-func (gom *Gom) pullPrivate(srcdir string) (err error) {
-	fmt.Printf("fetching private repo %s\n", gom.name)
-	pullCmd := fmt.Sprintf("git --work-tree=%s, --git-dir=%s/.git pull origin",
-		srcdir, srcdir)
-	pullArgs := strings.Split(pullCmd, " ")
-	err = run(pullArgs, Blue)
-	if err != nil {
-		return
+// moveFork moves the fork of gom, fetched under its own import path, to the
+// target. The fork is checked out at the revision gom is pinned to first,
+// since the branch or tag may only exist there, not in the original.
+func (gom *Gom) moveFork(vendor string) error {
+	// The whole repository is moved, not just the directory of a /vN
+	// import path.
+	var (
+		tag = getTarget(gom)
+		src = filepath.Join(vendor, "src", repoPath(getFork(gom)))
+		dst = filepath.Join(vendor, "src", repoPath(tag))
+	)
+	progressf("forking (%s, %s)\n", getFork(gom), tag)
+	if *dryRun {
+		fmt.Fprintf(stdout, "would move %s to %s\n", src, dst)
+		return nil
 	}
 
-	return
+	if vcs := detectVCS(src); vcs != nil && len(versionOptions(gom)) == 1 {
+		err := gom.checkoutIn(src, vcs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Leave nothing of an earlier revision behind.
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := copyDir(dst, src); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
 }
 
-func (gom *Gom) clonePrivate(srcdir string, useHttps bool) (err error) {
-	var privateUrl string
-	if useHttps {
-		privateUrl = fmt.Sprintf("https://%s.git", gom.name)
-	} else {
-		name := strings.Split(gom.name, "/")
-		privateUrl = fmt.Sprintf("git@%s:%s/%s", name[0], name[1], name[2])
+// cloneOffline makes do with what is on this machine for gom: its clone in
+// vendor, or else the one in the cache.
+func (gom *Gom) cloneOffline(vendor string) error {
+	if gom.isRelease() {
+		if isFile(filepath.Join(gom.dir(vendor), releaseMarker)) {
+			return nil
+		}
+	} else if gom.vcs(vendor) != nil {
+		return nil
+	} else if !has(gom.options, "fork") && gom.restoreFromCache(vendor, gom.name) {
+		return nil
 	}
+	return fmt.Errorf("%s isn't in %s, and -offline forbids fetching it", gom.name, vendor)
+}
+
+// pullArgs returns the command pulling the private repository in srcdir.
+func (gom *Gom) pullArgs(srcdir string) []string {
+	args := withGitJobs([]string{"git"})
+	args = append(args, gom.proxyArgs()...)
+	return append(args,
+		"--work-tree="+srcdir,
+		"--git-dir="+filepath.Join(srcdir, ".git"),
+		"pull", "origin")
+}
 
-	fmt.Printf("fetching private repo %s\n", gom.name)
-	cloneCmd := []string{"git", "clone", privateUrl, srcdir}
-	err = run(cloneCmd, Blue)
+func (gom *Gom) pullPrivate(srcdir string) (err error) {
+	progressf("fetching private repo %s\n", gom.name)
+	err = runRetry("", gom.pullArgs(srcdir), Blue)
 	if err != nil {
 		return
 	}
@@ -196,130 +703,1236 @@ func (gom *Gom) clonePrivate(srcdir string, useHttps bool) (err error) {
 	return
 }
 
-func (gom *Gom) Checkout() error {
-	commit_or_branch_or_tag := ""
-	if has(gom.options, "branch") {
-		commit_or_branch_or_tag, _ = gom.options["branch"].(string)
-	}
-	if has(gom.options, "tag") {
-		commit_or_branch_or_tag, _ = gom.options["tag"].(string)
+// fetchPrivate pulls the private repository name into srcdir if it was
+// cloned there before, or else clones it, after removing what an
+// interrupted clone left there.
+func (gom *Gom) fetchPrivate(srcdir, name string) error {
+	if incompleteClone(srcdir) && !*dryRun {
+		warnf("removing the incomplete clone %s of %s\n", srcdir, name)
+		if err := os.RemoveAll(srcdir); err != nil {
+			return err
+		}
 	}
-	if has(gom.options, "commit") {
-		commit_or_branch_or_tag, _ = gom.options["commit"].(string)
+	if isDir(srcdir) {
+		return gom.pullPrivate(srcdir)
 	}
-	if commit_or_branch_or_tag == "" {
-		return nil
+	useHttps := false
+	if possible, ok := gom.options["https"].(string); ok {
+		useHttps = boolString[strings.ToLower(possible)]
 	}
-	vendor, err := filepath.Abs(vendorFolder)
-	if err != nil {
+	if err := gom.requireTool("git"); err != nil {
 		return err
 	}
-	p := filepath.Join(vendor, "src")
-	for _, elem := range strings.Split(gom.name, "/") {
-		var vcs *vcsCmd
-		p = filepath.Join(p, elem)
-		if isDir(filepath.Join(p, ".git")) {
-			vcs = git
-		} else if isDir(filepath.Join(p, ".hg")) {
-			vcs = hg
-		} else if isDir(filepath.Join(p, ".bzr")) {
-			vcs = bzr
+	progressf("cloning private %s\n", name)
+	return gom.clonePrivate(srcdir, useHttps)
+}
+
+// privateURL returns the URL to clone the private repository name from.
+// Over SSH the first element of name is the host and the rest the path of
+// the repository on it.
+func privateURL(name string, useHttps bool) string {
+	if useHttps {
+		return fmt.Sprintf("https://%s.git", name)
+	}
+	elems := strings.SplitN(name, "/", 2)
+	if len(elems) < 2 {
+		return fmt.Sprintf("git@%s:", name)
+	}
+	return fmt.Sprintf("git@%s:%s", elems[0], elems[1])
+}
+
+// applySSHHosts makes the private goms on a host matching one of patterns,
+// such as *.internal.example.com, clone over SSH and the others over HTTPS,
+// unless they have an https option. The patterns of $GOM_SSH_HOSTS, comma
+// separated, are added to them. Without any, nothing changes.
+func applySSHHosts(goms []Gom, patterns []string) {
+	patterns = append(patterns, splitGroups(os.Getenv("GOM_SSH_HOSTS"))...)
+	if len(patterns) == 0 {
+		return
+	}
+	for _, gom := range goms {
+		private, _ := gom.options["private"].(string)
+		if !boolString[strings.ToLower(private)] || has(gom.options, "https") {
+			continue
 		}
-		if vcs != nil {
-			p = filepath.Join(vendor, "src", gom.name)
-			return vcs.Sync(p, commit_or_branch_or_tag)
+		host := hostOf(gom.name)
+		ssh := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, host); ok {
+				ssh = true
+				break
+			}
 		}
+		gom.options["https"] = strconv.FormatBool(!ssh)
 	}
-	fmt.Printf("Warning: don't know how to checkout for %v\n", gom.name)
-	return errors.New("gom currently support git/hg/bzr for specifying tag/branch/commit")
 }
 
-func (gom *Gom) Build(args []string) error {
-	installCmd := append([]string{"go", "install"}, args...)
-	vendor, err := filepath.Abs(vendorFolder)
+// applyDefaultBranches makes the goms on a host matching the pattern of one
+// of defaults check out its branch, when they have no branch, tag, commit
+// or ref option. The pairs of $GOM_DEFAULT_BRANCHES come first, and the
+// first matching pattern wins.
+func applyDefaultBranches(goms []Gom, defaults []hostBranch) error {
+	env, err := parseHostBranches(os.Getenv("GOM_DEFAULT_BRANCHES"))
 	if err != nil {
-		return err
+		return fmt.Errorf("GOM_DEFAULT_BRANCHES: %v", err)
+	}
+	defaults = append(env, defaults...)
+	for i := range goms {
+		gom := &goms[i]
+		if len(versionOptions(gom)) > 0 || gom.isRelease() {
+			continue
+		}
+		if _, ok := gom.localPath(); ok {
+			continue
+		}
+		host := hostOf(gom.name)
+		for _, d := range defaults {
+			if ok, _ := path.Match(d.pattern, host); ok {
+				gom.options["branch"] = d.branch
+				break
+			}
+		}
 	}
-	p := filepath.Join(vendor, "src", gom.name)
-	return vcsExec(p, installCmd...)
+	return nil
 }
 
-func isFile(p string) bool {
-	if fi, err := os.Stat(filepath.Join(p)); err == nil && !fi.IsDir() {
-		return true
-	}
-	return false
+// tokenURL returns the HTTPS URL u authenticating with token, as GitHub and
+// GitLab accept it.
+func tokenURL(u, token string) string {
+	return credentialURL(u, "x-access-token", token)
 }
 
-func isDir(p string) bool {
-	if fi, err := os.Stat(filepath.Join(p)); err == nil && fi.IsDir() {
-		return true
+// credentialURL returns the HTTPS URL u authenticating as login.
+func credentialURL(u, login, password string) string {
+	user := url.UserPassword(login, password).String()
+	return strings.Replace(u, "https://", "https://"+user+"@", 1)
+}
+
+// addURLSecret masks secret in the output, as it is and escaped as it is
+// in a URL.
+func addURLSecret(secret string) {
+	addSecret(secret)
+	addSecret(url.PathEscape(secret))
+	addSecret(url.QueryEscape(secret))
+}
+
+// token returns the access token to clone gom over HTTPS with, read from the
+// environment variable named by its token_env option or GOM_GIT_TOKEN.
+func (gom *Gom) token() string {
+	env, ok := gom.options["token_env"].(string)
+	if !ok {
+		env = "GOM_GIT_TOKEN"
 	}
-	return false
+	return os.Getenv(env)
 }
 
-func install(args []string) error {
-	allGoms, err := parseGomfile("Gomfile")
-	if err != nil {
+// clonePrivate clones the private gom into srcdir over HTTPS or SSH. If the
+// host refuses the credentials of one, the other is tried before giving up,
+// as the wrong one for the environment is a common mistake, such as SSH in
+// CI without keys.
+func (gom *Gom) clonePrivate(srcdir string, useHttps bool) error {
+	out, err := gom.clonePrivateOver(srcdir, useHttps)
+	if err == nil || *dryRun || !isAuthError(out) {
 		return err
 	}
-	vendor, err := filepath.Abs(vendorFolder)
-	if err != nil {
-		return err
+	warnf("%s refused to authenticate the clone of %s over %s, trying %s\n", hostOf(gom.name), gom.name, protocolName(useHttps), protocolName(!useHttps))
+	if _, ferr := gom.clonePrivateOver(srcdir, !useHttps); ferr == nil {
+		return nil
 	}
-	_, err = os.Stat(vendor)
-	if err != nil {
-		err = os.MkdirAll(vendor, 0755)
+	return err
+}
+
+func protocolName(useHttps bool) string {
+	if useHttps {
+		return "HTTPS"
+	}
+	return "SSH"
+}
+
+// hostOf returns the host of the import path name.
+func hostOf(name string) string {
+	return strings.SplitN(name, "/", 2)[0]
+}
+
+// clonePrivateOver clones the private gom into srcdir over HTTPS or SSH, and
+// returns the standard error of git.
+func (gom *Gom) clonePrivateOver(srcdir string, useHttps bool) (string, error) {
+	// Without credentials in it, git authenticates with ~/.netrc.
+	privateUrl := privateURL(repoPath(gom.name), useHttps)
+	cloneUrl := privateUrl
+	if token := gom.token(); useHttps && token != "" {
+		addURLSecret(token)
+		cloneUrl = tokenURL(privateUrl, token)
+	} else if useHttps && *netrcFile != "" {
+		machines, err := parseNetrc(*netrcFile)
 		if err != nil {
-			return err
+			return "", err
 		}
+		u, err := url.Parse(privateUrl)
+		if err != nil {
+			return "", err
+		}
+		if login, password, ok := netrcLogin(machines, u.Hostname()); ok {
+			addURLSecret(password)
+			cloneUrl = credentialURL(privateUrl, login, password)
+		}
+	}
+
+	progressf("fetching private repo %s\n", gom.name)
+	cloneCmd := []string{"git"}
+	if useHttps {
+		// SSH doesn't go through HTTP proxies.
+		cloneCmd = append(cloneCmd, gom.proxyArgs()...)
 	}
-	err = os.Setenv("GOPATH", vendor)
+	cloneCmd = append(withGitJobs(cloneCmd), "clone")
+	if depth := gom.depth(); depth != "" {
+		cloneCmd = append(cloneCmd, "--depth", depth, "--no-single-branch")
+	}
+	cloneCmd = append(cloneCmd, cloneUrl)
+	out, err := cloneInto(cloneCmd, srcdir)
 	if err != nil {
-		return err
+		return out, err
 	}
+	if cloneUrl != privateUrl && !*dryRun {
+		// Don't leave the token in .git/config of the vendored repository.
+		_, err = vcsOutput(srcdir, "git", "remote", "set-url", "origin", privateUrl)
+	}
+	return out, err
+}
 
-	// 1. Filter goms to install
-	goms := make([]Gom, 0)
-	for _, gom := range allGoms {
+// partialClone returns the directory srcdir is cloned into before it is
+// complete.
+func partialClone(srcdir string) string {
+	return filepath.Join(filepath.Dir(srcdir), "."+filepath.Base(srcdir)+".partial")
+}
+
+// cloneInto runs the clone command args into the partialClone of srcdir,
+// and renames it to srcdir once the clone is complete, so srcdir never
+// holds half a repository. What a clone killed halfway, e.g. after
+// -timeout, leaves behind is removed before it's retried, as git refuses to
+// clone into an existing directory.
+func cloneInto(args []string, srcdir string) (string, error) {
+	if *dryRun {
+		return runRetryOutput("", append(args, srcdir), Blue)
+	}
+	partial := partialClone(srcdir)
+	clean := func() error { return os.RemoveAll(partial) }
+	if err := clean(); err != nil {
+		return "", err
+	}
+	out, err := retryOutput("", append(args, partial), Blue, clean)
+	if err != nil {
+		clean()
+		return out, err
+	}
+	err = os.RemoveAll(srcdir)
+	if err != nil {
+		return out, err
+	}
+	return out, os.Rename(partial, srcdir)
+}
+
+// incompleteClone returns true if p holds the version control directory of
+// a clone that didn't get as far as checking out a revision.
+func incompleteClone(p string) bool {
+	vcs := detectVCS(p)
+	if vcs == nil || vcs.revision == nil {
+		return false
+	}
+	_, err := vcs.Revision(p)
+	return err != nil
+}
+
+// proxyEnv are the environment variables a proxy for HTTPS fetches is
+// read from, in order of preference. Unlike curl, gom also accepts the
+// upper case HTTP_PROXY.
+var proxyEnv = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// proxyArgs returns the git options making HTTP fetches of gom go through
+// the proxy given by its proxy option or the environment, if any.
+func (gom *Gom) proxyArgs() []string {
+	proxy, _ := gom.options["proxy"].(string)
+	for i := 0; proxy == "" && i < len(proxyEnv); i++ {
+		proxy = os.Getenv(proxyEnv[i])
+	}
+	if proxy == "" {
+		return nil
+	}
+	return []string{"-c", "http.proxy=" + proxy}
+}
+
+// withGitJobs returns the command args with the git options fetching up
+// to -git-jobs remotes and submodules at once, if it is a git command and
+// -git-jobs is given. Other commands are returned as they are.
+func withGitJobs(args []string) []string {
+	if *gitJobs <= 0 || len(args) == 0 || args[0] != "git" {
+		return args
+	}
+	n := strconv.Itoa(*gitJobs)
+	return append([]string{"git", "-c", "fetch.parallel=" + n, "-c", "submodule.fetchJobs=" + n}, args[1:]...)
+}
+
+// depth returns the history depth gom should be cloned with, or "" for
+// the full history. Only clones made by gom itself honor it; "go get"
+// always fetches everything.
+func (gom *Gom) depth() string {
+	if depth, ok := gom.options["depth"].(string); ok {
+		return depth
+	}
+	if *shallow {
+		return "1"
+	}
+	return ""
+}
+
+// findRepo walks down the import path below the src directory and returns
+// the root of the first repository found and its vcsCmd, or nil.
+func findRepo(src, importPath string) (string, *vcsCmd) {
+	p := src
+	for _, elem := range strings.Split(importPath, "/") {
+		p = filepath.Join(p, elem)
+		if vcs := detectVCS(p); vcs != nil {
+			return p, vcs
+		}
+	}
+	return "", nil
+}
+
+// dir returns the directory of gom below the vendor directory. That is its
+// target, where a fork is copied to, rather than its name.
+func (gom *Gom) dir(vendor string) string {
+	return filepath.Join(vendor, "src", filepath.FromSlash(getTarget(gom)))
+}
+
+// vcs walks up the target of gom below the vendor directory and returns the
+// vcsCmd of the first repository found, or nil.
+func (gom *Gom) vcs(vendor string) *vcsCmd {
+	_, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	return vcs
+}
+
+// version returns the commit, tag or branch gom is pinned to, in that
+// order of precedence, or "".
+func (gom *Gom) version() string {
+	commit_or_branch_or_tag := ""
+	if has(gom.options, "branch") {
+		commit_or_branch_or_tag, _ = gom.options["branch"].(string)
+	}
+	if has(gom.options, "tag") {
+		commit_or_branch_or_tag, _ = gom.options["tag"].(string)
+	}
+	if has(gom.options, "commit") {
+		commit_or_branch_or_tag, _ = gom.options["commit"].(string)
+	}
+	if has(gom.options, "ref") {
+		commit_or_branch_or_tag, _ = gom.options["ref"].(string)
+	}
+	return commit_or_branch_or_tag
+}
+
+// checkoutRef fetches the git ref gom is pinned to, such as
+// refs/pull/123/head, into the repository p and checks it out. Refs other
+// than branches and tags aren't fetched by a clone, so it is fetched every
+// time.
+func (gom *Gom) checkoutRef(p string, vcs *vcsCmd, ref string) error {
+	if vcs != git {
+		return fmt.Errorf("%s: the ref option needs a git repository, but it is %s", gom.name, vcs.name)
+	}
+	if *offline {
+		return fmt.Errorf("%s: -offline forbids fetching %s", gom.name, ref)
+	}
+	err := gom.requireTool(vcs.name)
+	if err != nil {
+		return err
+	}
+	err = vcsExec(p, Blue, withGitJobs([]string{"git", "fetch", "-q", "origin", ref})...)
+	if err != nil {
+		return err
+	}
+	return vcs.Checkout(p, "FETCH_HEAD")
+}
+
+// checkoutIn checks out the revision gom is pinned to in the repository p,
+// resolving a tag that is a version constraint against its tags.
+func (gom *Gom) checkoutIn(p string, vcs *vcsCmd) error {
+	key := versionOptions(gom)[0]
+	commit_or_branch_or_tag := gom.version()
+	if key == "ref" {
+		return gom.checkoutRef(p, vcs, commit_or_branch_or_tag)
+	}
+	if tag, _ := gom.options["tag"].(string); tag == commit_or_branch_or_tag && isVersionConstraint(tag) {
+		var err error
+		commit_or_branch_or_tag, err = vcs.ResolveTag(p, tag)
+		if err != nil {
+			return fmt.Errorf("%s: %v", gom.name, err)
+		}
+		progressf("resolved %s %s to %s\n", gom.name, tag, commit_or_branch_or_tag)
+	}
+	err := gom.requireTool(vcs.name)
+	if err != nil {
+		return err
+	}
+	if vcs == hg {
+		commit_or_branch_or_tag = hgRevset(key, commit_or_branch_or_tag, key == "branch" && hgBookmark(p, commit_or_branch_or_tag))
+	}
+	// A branch is checked out even at the right commit, to be on it.
+	if !*force && key != "branch" && atRevision(p, vcs, commit_or_branch_or_tag) {
+		tracef("%s is already at %s\n", gom.name, commit_or_branch_or_tag)
+		return nil
+	}
+	return vcs.Sync(p, commit_or_branch_or_tag)
+}
+
+func (gom *Gom) Checkout() (err error) {
+	defer reportStep("checkout", gom.name, time.Now(), &err)
+	if source, keys := ignoredVersionOptions(gom); len(keys) > 0 {
+		return fmt.Errorf("%s has conflicting options %s, %s: a %s package isn't checked out", gom.name, strings.Join(keys, ", "), source, source)
+	}
+	if _, ok := gom.localPath(); ok {
+		// The local directory is used as it is.
+		return nil
+	}
+	keys := versionOptions(gom)
+	if len(keys) > 1 {
+		return fmt.Errorf("%s has conflicting options %s, give only one of them", gom.name, strings.Join(keys, ", "))
+	}
+	if gom.isRelease() {
+		// Clone downloaded the artifact of the release of the tag.
+		return nil
+	}
+	commit_or_branch_or_tag := gom.version()
+	if commit_or_branch_or_tag == "" {
+		return nil
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	// The directory of a /vN import path may only exist at some revisions.
+	if root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom)); vcs != nil {
+		err = gom.revertPatch(root, vcs)
+		if err != nil {
+			return err
+		}
+		return gom.checkoutIn(root, vcs)
+	}
+	if *dryRun {
+		// Nothing has been cloned to find out the VCS from.
+		fmt.Fprintf(stdout, "would check out %s of %s\n", commit_or_branch_or_tag, gom.name)
+		return nil
+	}
+	warnf("don't know how to checkout for %v\n", gom.name)
+	return &UnsupportedVCSError{gom.name}
+}
+
+// submoduleRepo returns the root of the git repository of gom in vendor if
+// its submodules are to be checked out: when it has a .gitmodules file,
+// unless the submodules option is false, or when the option is true.
+func (gom *Gom) submoduleRepo(vendor string) string {
+	if _, ok := gom.localPath(); ok {
+		return ""
+	}
+	root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(gom))
+	if vcs != git {
+		return ""
+	}
+	if submodules, ok := gom.options["submodules"].(string); ok {
+		if !boolString[strings.ToLower(submodules)] {
+			return ""
+		}
+	} else if !isFile(filepath.Join(root, ".gitmodules")) {
+		return ""
+	}
+	return root
+}
+
+// UpdateSubmodules checks out the git submodules of gom at the revisions
+// its checkout records, if it has any.
+func (gom *Gom) UpdateSubmodules() error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	root := gom.submoduleRepo(vendor)
+	if root == "" {
+		return nil
+	}
+	progressf("updating submodules of %s\n", gom.name)
+	return vcsExec(root, Cyan, withGitJobs([]string{"git", "submodule", "update", "--init", "--recursive"})...)
+}
+
+// PostCheckout runs the post_checkout option of gom in its directory, such
+// as go generate for generated code it needs before it builds. A TOML
+// Gomfile may give several commands, run in order. They are split like the
+// hooks of the Gomfile and killed after -timeout like the checkout.
+func (gom *Gom) PostCheckout() error {
+	var hooks []string
+	switch hook := gom.options["post_checkout"].(type) {
+	case string:
+		hooks = []string{hook}
+	case []string:
+		hooks = hook
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		args, err := splitCommand(hook)
+		if err != nil {
+			return fmt.Errorf("%s: post_checkout hook: %v", gom.name, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		progressf("running post_checkout hook %s of %s\n", hook, gom.name)
+		err = runTee(gom.dir(vendor), args, None, nil, *timeout)
+		if err != nil {
+			return fmt.Errorf("%s: post_checkout hook %q failed: %w", gom.name, hook, err)
+		}
+	}
+	return nil
+}
+
+// finishCheckout does what follows each checkout of gom, by install as by
+// update: checking out its submodules, applying its patch and running its
+// post_checkout commands.
+func (gom *Gom) finishCheckout() error {
+	err := gom.UpdateSubmodules()
+	if err != nil {
+		return err
+	}
+	err = gom.ApplyPatch()
+	if err != nil {
+		return err
+	}
+	return gom.PostCheckout()
+}
+
+// goBuildFlags are the flags of go build and whether they take a value.
+// gom passes them through even if it has a flag of the same name.
+var goBuildFlags = map[string]bool{
+	"a": false, "n": false, "p": true, "race": false, "msan": false,
+	"asan": false, "cover": false, "covermode": true, "coverpkg": true,
+	"v": false, "work": false, "x": false, "asmflags": true,
+	"buildmode": true, "buildvcs": true, "compiler": true,
+	"gccgoflags": true, "gcflags": true, "installsuffix": true,
+	"ldflags": true, "linkshared": false, "mod": true, "modcacherw": false,
+	"modfile": true, "overlay": true, "pgo": true, "pkgdir": true,
+	"tags": true, "trimpath": false, "toolexec": true, "o": true,
+}
+
+// splitPackages splits the arguments of go into its flags, with their
+// values, and the import paths given after or among them.
+func splitPackages(args []string) ([]string, []string) {
+	flags := make([]string, 0, len(args))
+	names := make([]string, 0)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			names = append(names, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if takesValue := goBuildFlags[name]; takesValue && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return flags, names
+}
+
+// goArgs returns the arguments given to a task for go, without the flags
+// of gom itself, which belong before the task as in gom -dry-run install.
+func goArgs(args []string) []string {
+	result := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		hasValue := strings.Contains(name, "=")
+		if hasValue {
+			name = name[:strings.Index(name, "=")]
+		}
+		f := flag.Lookup(name)
+		takesValue, isGoFlag := goBuildFlags[name]
+		if !strings.HasPrefix(arg, "-") || name == "" || f == nil || isGoFlag {
+			result = append(result, arg)
+			if isGoFlag && takesValue && !hasValue && i+1 < len(args) {
+				i++
+				result = append(result, args[i])
+			}
+			continue
+		}
+		warnf("ignoring %s, an option of gom to give before the task\n", arg)
+		if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && !(ok && bf.IsBoolFlag()) && i+1 < len(args) {
+			// Its value too.
+			i++
+		}
+	}
+	return result
+}
+
+// buildFlags returns the flags go install builds gom with: the -tags of gom
+// and the buildflags option, a list or a space separated string.
+func (gom *Gom) buildFlags() []string {
+	flags := make([]string, 0)
+	if *buildTags != "" {
+		flags = append(flags, "-tags", *buildTags)
+	}
+	switch v := gom.options["buildflags"].(type) {
+	case string:
+		flags = append(flags, strings.Fields(v)...)
+	case []string:
+		flags = append(flags, v...)
+	}
+	return flags
+}
+
+// builds returns false if gom is only fetched, its build option being false,
+// such as a tool run with gom exec that doesn't build as a library.
+func (gom *Gom) builds() bool {
+	if build, ok := gom.options["build"].(string); ok {
+		return boolString[strings.ToLower(build)]
+	}
+	return true
+}
+
+// installCommand returns the go install command building gom with args.
+// The flags, its buildFlags among them, go before the packages of args, as
+// go takes everything after the first package for a package too.
+func (gom *Gom) installCommand(args []string) []string {
+	flags, pkgs := splitPackages(args)
+	installCmd := append([]string{goCommand(), "install"}, flags...)
+	installCmd = append(installCmd, gom.buildFlags()...)
+	return append(installCmd, pkgs...)
+}
+
+func (gom *Gom) Build(args []string) (err error) {
+	defer reportStep("build", gom.name, time.Now(), &err)
+	installCmd := gom.installCommand(args)
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	p := gom.dir(vendor)
+	if gom.isRelease() && !hasGoFiles(p) {
+		// Only the artifact is wanted, such as a binary.
+		return nil
+	}
+	if !gom.builds() {
+		return nil
+	}
+	err = vcsExec(p, Green, installCmd...)
+	if err != nil {
+		return &BuildError{gom.name, err}
+	}
+	return nil
+}
+
+func isFile(p string) bool {
+	if fi, err := os.Stat(filepath.Join(p)); err == nil && !fi.IsDir() {
+		return true
+	}
+	return false
+}
+
+func isDir(p string) bool {
+	if fi, err := os.Stat(filepath.Join(p)); err == nil && fi.IsDir() {
+		return true
+	}
+	return false
+}
+
+// resolveGoms returns the goms of allGoms install installs, or the named
+// ones, pinned to Gomfile.lock and with the host defaults of the Gomfile
+// applied, and the settings of the Gomfile.
+func resolveGoms(allGoms []Gom, names []string) ([]Gom, settings, error) {
+	if !*noLock && isFile(lockfilePath()) {
+		locks, err := parseLockfile(lockfilePath())
+		if err != nil {
+			return nil, nil, err
+		}
+		applyLocks(allGoms, locks)
+	}
+	goms, err := selectGoms(filterGoms(allGoms), names)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := parseSettings(gomfilePath())
+	if err != nil {
+		return nil, nil, err
+	}
+	applySSHHosts(goms, h.sshHosts())
+	defaults, err := h.defaultBranches()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = applyDefaultBranches(goms, defaults)
+	if err != nil {
+		return nil, nil, err
+	}
+	return goms, h, nil
+}
+
+func install(args []string) error {
+	args, names := splitPackages(goArgs(args))
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(vendor)
+	if err != nil && !*dryRun {
+		err = os.MkdirAll(vendor, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	vendorGopath = vendor
+
+	if *frozen {
+		if !isFile(lockfilePath()) {
+			return fmt.Errorf("-frozen needs %s, run gom lock first", lockfilePath())
+		}
+		locks, err := parseLockfile(lockfilePath())
+		if err != nil {
+			return err
+		}
+		problems := staleLocks(filterGoms(allGoms), locks)
+		if len(problems) > 0 {
+			return fmt.Errorf("%s is out of date, run gom lock:\n%s", lockfilePath(), strings.Join(problems, "\n"))
+		}
+	}
+
+	// 1. Filter goms to install, and select the named ones
+	goms, h, err := resolveGoms(allGoms, names)
+	if err != nil {
+		return err
+	}
+	err = h.run("pre_install")
+	if err != nil {
+		return err
+	}
+	archive := useVendorCache(goms, names, args)
+	if archive != "" && isFile(archive) {
+		err = restoreVendor(archive, vendor)
+		if err == nil {
+			progressf("restored %s from %s\n", vendorFolder, archive)
+			// The archive is checked as a checkout would be.
+			sums, err := verifyChecksums(goms, vendor)
+			if err != nil {
+				return err
+			}
+			err = writeSumfile(sumfilePath(), sums)
+			if err != nil {
+				return err
+			}
+			return h.run("post_install")
+		}
+		warnf("can't restore %s from %s, installing it: %v\n", vendorFolder, archive, err)
+	}
+
+	// 2. Clone the repositories, once it's known what they need is there
+	var sum installSummary
+	sum.direct = len(goms)
+	start := time.Now()
+	err = requireTools(goms, vendor)
+	if err != nil {
+		return err
+	}
+	if *repair {
+		_, err = removeCorrupt(goms, vendor)
+		if err != nil {
+			return err
+		}
+	}
+	err = cloneAll(goms, args)
+	if err != nil {
+		return err
+	}
+	goms, err = cloneRecursive(goms, args, vendor)
+	if err != nil {
+		return err
+	}
+	sum.transitive = len(goms) - sum.direct
+	sum.timePhase("fetch", start)
+
+	// 3. Checkout the commit/branch/tag if needed
+	start = time.Now()
+	for _, gom := range goms {
+		err = gom.Checkout()
+		if err != nil {
+			return err
+		}
+		err = gom.finishCheckout()
+		if err != nil {
+			return err
+		}
+	}
+
+	sum.timePhase("checkout", start)
+
+	// 4. Verify the checked out trees
+	start = time.Now()
+	var sums []checksum
+	if !*dryRun {
+		sums, err = verifyChecksums(goms, vendor)
+		if err != nil {
+			return err
+		}
+	}
+
+	sum.timePhase("verify", start)
+
+	// 5. Build and install
+	start = time.Now()
+	err = buildAll(goms, args)
+	if err != nil {
+		return err
+	}
+	sum.timePhase("build", start)
+
+	if !*dryRun {
+		err = writeSumfile(sumfilePath(), sums)
+		if err != nil {
+			return err
+		}
+		sum.vendorBytes, err = dirSize(vendor)
+		if err != nil {
+			return err
+		}
+		report.summary(sum)
+	}
+	if archive != "" {
+		err = archiveDir(archive, vendor)
+		if err != nil {
+			warnf("can't archive %s to %s: %v\n", vendorFolder, archive, err)
+		} else {
+			progressf("archived %s to %s\n", vendorFolder, archive)
+		}
+	}
+
+	// 6. Run what the project needs done with the bundles, e.g. generate code
+	return h.run("post_install")
+}
+
+// selectGoms returns the goms named, or all of them if none are. A name
+// that isn't one of goms is an error, rather than something to fetch.
+func selectGoms(goms []Gom, names []string) ([]Gom, error) {
+	if len(names) == 0 {
+		return goms, nil
+	}
+	selected := make([]Gom, 0)
+	for _, name := range names {
+		found := false
+		for _, gom := range goms {
+			if gom.name == normalizeImportPath(name) {
+				selected = append(selected, gom)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s is not in Gomfile", name)
+		}
+	}
+	return selected, nil
+}
+
+// filterGoms returns the goms whose group, goos and goarch options match
+// the current environment.
+func filterGoms(allGoms []Gom) []Gom {
+	goms := make([]Gom, 0)
+	for _, gom := range allGoms {
 		if group, ok := gom.options["group"]; ok {
 			if !matchEnv(group) {
+				if *dryRun {
+					fmt.Fprintf(stdout, "skipping %s (group %s)\n", gom.name, formatOption(group))
+				}
 				continue
 			}
 		}
 		if goos, ok := gom.options["goos"]; ok {
 			if !matchOS(goos) {
+				if *dryRun {
+					fmt.Fprintf(stdout, "skipping %s (goos %s)\n", gom.name, formatOption(goos))
+				}
+				continue
+			}
+		}
+		if goarch, ok := gom.options["goarch"]; ok {
+			if !matchArch(goarch) {
+				if *dryRun {
+					fmt.Fprintf(stdout, "skipping %s (goarch %s)\n", gom.name, formatOption(goarch))
+				}
 				continue
 			}
 		}
 		goms = append(goms, gom)
 	}
+	return goms
+}
 
-	// 2. Clone the repositories
-	for _, gom := range goms {
-		err = gom.Clone(args)
+// fetchedByGoGet returns true if gom is fetched with go get alone, without
+// a fork, replacement, private clone, custom command or anything else
+// Clone has to do first.
+func (gom *Gom) fetchedByGoGet() bool {
+	if _, ok := gom.localPath(); ok || *offline || gom.isRelease() {
+		return false
+	}
+	if has(gom.options, "replace") || has(gom.options, "fork") || has(gom.options, "command") {
+		return false
+	}
+	if private, ok := gom.options["private"].(string); ok && boolString[strings.ToLower(private)] {
+		return false
+	}
+	return true
+}
+
+// resolve fetches goms, all fetched by go get alone, with a single go get,
+// so the dependencies they share are downloaded once.
+func resolve(goms []*Gom, args []string) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	cached := make([]bool, len(goms))
+	names := make([]string, 0, len(goms))
+	completes := make([]func(), 0, len(goms))
+	for i, gom := range goms {
+		completes = append(completes, creating(fetchDir(vendor, gom.name)))
+		cached[i] = gom.restoreFromCache(vendor, gom.name)
+		names = append(names, gom.name)
+	}
+	cmdArgs := []string{goCommand(), "get", "-d"}
+	cmdArgs = append(cmdArgs, args...)
+	cmdArgs = append(cmdArgs, names...)
+
+	progressf("downloading %s\n", strings.Join(names, ", "))
+	err = runRetry("", cmdArgs, Blue)
+	for i, gom := range goms {
+		if err == nil {
+			completes[i]()
+		}
+		if err == nil && !cached[i] {
+			gom.saveToCache(vendor, gom.name)
+		}
+		stepErr := err
+		reportStep("clone", gom.name, start, &stepErr)
+	}
+	return err
+}
+
+// cloneAll clones goms, but those already up to date. The ones fetched by
+// go get alone are resolved together first, then the others are cloned
+// using up to *jobs workers. The first failure stops any further clones
+// from being started and is returned once the in-flight ones have finished.
+func cloneAll(goms []Gom, args []string) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	pending := make([]Gom, 0)
+	plain := make([]*Gom, 0)
+	rest := make([]Gom, 0)
+	for i := range goms {
+		if goms[i].upToDate(vendor) {
+			progressf("%s is already at %s\n", goms[i].name, goms[i].version())
+			continue
+		}
+		if goms[i].fetchedByGoGet() {
+			plain = append(plain, &goms[i])
+		} else {
+			rest = append(rest, goms[i])
+		}
+		pending = append(pending, goms[i])
+	}
+	goms = pending
+	if len(plain) > 1 {
+		err := resolve(plain, args)
 		if err != nil {
 			return err
 		}
+		goms = rest
 	}
 
-	// 3. Checkout the commit/branch/tag if needed
-	for _, gom := range goms {
-		err = gom.Checkout()
+	n := *jobs
+	if n > len(goms) {
+		n = len(goms)
+	}
+	if n <= 1 {
+		for _, gom := range goms {
+			err := gom.Clone(args)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	parallel = true
+	defer func() { parallel = false }()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		queue    = make(chan *Gom)
+		failed   = make(chan struct{})
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for gom := range queue {
+				if err := gom.Clone(args); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for i := range goms {
+		select {
+		case queue <- &goms[i]:
+		case <-failed:
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// buildDeps returns, for each of goms, the others whose packages its own
+// packages import, which are built first. It fails if they import each
+// other in a cycle.
+func buildDeps(goms []Gom, vendor string) ([][]int, error) {
+	src := filepath.Join(vendor, "src")
+	targets := make([]string, len(goms))
+	index := make(map[string]int)
+	for i := range goms {
+		targets[i] = getTarget(&goms[i])
+		index[targets[i]] = i
+	}
+	deps := make([][]int, len(goms))
+	for i := range goms {
+		pkgs, err := gomPackages(src, goms[i:i+1])
 		if err != nil {
-			return err
+			return nil, err
+		}
+		seen := make(map[int]bool)
+		for _, pkg := range pkgs {
+			imports, err := packageImports(filepath.Join(src, filepath.FromSlash(pkg)))
+			if err != nil {
+				continue
+			}
+			for _, imp := range imports {
+				repo := repoOf(targets, imp)
+				if repo == "" {
+					continue
+				}
+				if j := index[repo]; j != i && !seen[j] {
+					seen[j] = true
+					deps[i] = append(deps[i], j)
+				}
+			}
 		}
 	}
 
-	// 4. Build and install
-	for _, gom := range goms {
-		err = gom.Build(args)
+	// Kahn's algorithm leaves the goms of a cycle unvisited.
+	remaining, dependents, ready := buildQueue(deps)
+	visited := 0
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, d := range dependents[i] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if visited < len(goms) {
+		return nil, errors.New("bundles import each other in a cycle")
+	}
+	return deps, nil
+}
+
+// buildQueue returns, for the deps of buildDeps, how many goms each one
+// waits for, the goms waiting for each one, and those waiting for none.
+func buildQueue(deps [][]int) ([]int, [][]int, []int) {
+	remaining := make([]int, len(deps))
+	dependents := make([][]int, len(deps))
+	ready := make([]int, 0)
+	for i := range deps {
+		remaining[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+		if remaining[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	return remaining, dependents, ready
+}
+
+// buildAll builds goms, up to -j at a time, each one once the goms it
+// imports are built. If their imports can't be told apart, they are built
+// one after the other, in order.
+func buildAll(goms []Gom, args []string) error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	n := *jobs
+	if n > len(goms) {
+		n = len(goms)
+	}
+	var deps [][]int
+	if n > 1 {
+		deps, err = buildDeps(goms, vendor)
 		if err != nil {
-			return err
+			tracef("building one bundle at a time: %v\n", err)
+		}
+	}
+	if deps == nil {
+		for _, gom := range goms {
+			err := gom.Build(args)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
-	return nil
+	parallel = true
+	defer func() { parallel = false }()
+
+	type result struct {
+		i   int
+		err error
+	}
+	var (
+		wg      sync.WaitGroup
+		queue   = make(chan int)
+		results = make(chan result)
+	)
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results <- result{i, goms[i].Build(args)}
+			}
+		}()
+	}
+
+	remaining, dependents, ready := buildQueue(deps)
+	var firstErr error
+	running := 0
+	handle := func(r result) {
+		running--
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			return
+		}
+		for _, d := range dependents[r.i] {
+			remaining[d]--
+			if remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	for {
+		if firstErr == nil && len(ready) > 0 {
+			select {
+			case queue <- ready[0]:
+				ready = ready[1:]
+				running++
+			case r := <-results:
+				handle(r)
+			}
+		} else if running > 0 {
+			handle(<-results)
+		} else {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// dependencies returns the goms of the Gomfile shipped with gom, if any.
+func (gom *Gom) dependencies(vendor string) ([]Gom, error) {
+	dir := filepath.Join(vendor, "src", getTarget(gom))
+	for _, name := range []string{"Gomfile.toml", "Gomfile"} {
+		filename := filepath.Join(dir, name)
+		if isFile(filename) {
+			goms, err := parseGomfile(filename)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+			for _, g := range goms {
+				// Local paths are relative to the Gomfile naming them.
+				if local, ok := g.localPath(); ok && !filepath.IsAbs(local) {
+					g.options["path"] = filepath.Join(dir, local)
+				}
+			}
+			return filterGoms(goms), nil
+		}
+	}
+	return nil, nil
+}
+
+// cloneRecursive clones the dependencies of the goms with the recursive
+// option, and theirs if they have it too, and returns them appended to
+// goms. A gom is only fetched once, with the constraints of the first
+// Gomfile naming it, so the project's own Gomfile takes precedence.
+func cloneRecursive(goms []Gom, args []string, vendor string) ([]Gom, error) {
+	visited := make(map[string]bool)
+	for _, gom := range goms {
+		visited[gom.name] = true
+	}
+	for i := 0; i < len(goms); i++ {
+		recursive, _ := goms[i].options["recursive"].(string)
+		if !boolString[strings.ToLower(recursive)] {
+			continue
+		}
+		deps, err := goms[i].dependencies(vendor)
+		if err != nil {
+			return nil, err
+		}
+		fresh := make([]Gom, 0)
+		for _, dep := range deps {
+			if visited[dep.name] {
+				continue
+			}
+			visited[dep.name] = true
+			fresh = append(fresh, dep)
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		progressf("installing dependencies of %s\n", goms[i].name)
+		err = cloneAll(fresh, args)
+		if err != nil {
+			return nil, err
+		}
+		goms = append(goms, fresh...)
+	}
+	return goms, nil
 }
 
 func getTarget(gom *Gom) string {
@@ -330,6 +1943,17 @@ func getTarget(gom *Gom) string {
 	return target
 }
 
+// majorVersion matches the /vN ending the import path of a module at major
+// version 2 or later, which isn't part of the path of its repository.
+var majorVersion = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+// repoPath returns the path of the repository holding the package at
+// importPath: importPath without any major version suffix, so
+// github.com/username/repo/v2 is in github.com/username/repo.
+func repoPath(importPath string) string {
+	return majorVersion.ReplaceAllString(importPath, "")
+}
+
 func getFork(gom *Gom) string {
 	if has(gom.options, "fork") {
 		return gom.options["fork"].(string)
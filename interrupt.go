@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// interrupted is canceled once gom gets SIGINT, SIGTERM or SIGHUP, which
+// kills the commands it is running.
+var interrupted, interrupt = context.WithCancel(context.Background())
+
+// interruptSignal is the number of the signal gom was interrupted by, or 0.
+var interruptSignal int32
+
+// interruptedStatus returns the exit status of gom once it is interrupted:
+// 128 plus the number of the signal, as shells report it.
+func interruptedStatus() int {
+	if n := atomic.LoadInt32(&interruptSignal); n != 0 {
+		return 128 + int(n)
+	}
+	return exitInterrupted
+}
+
+// running counts the commands started and not done with yet.
+var running int32
+
+// partialDirs holds the directories of the goms being fetched that didn't
+// exist before, until they are complete.
+var partialDirs = struct {
+	sync.Mutex
+	dirs map[string]bool
+}{dirs: map[string]bool{}}
+
+// fetchDir returns the directory the repository of the package name is
+// fetched into below the vendor directory.
+func fetchDir(vendor, name string) string {
+	return filepath.Join(vendor, "src", filepath.FromSlash(repoRoot(repoPath(name))))
+}
+
+// creating records that dir is being created, unless it exists already, and
+// returns the function to call once it is complete. If gom is interrupted
+// before then, dir is removed.
+func creating(dir string) func() {
+	if _, err := os.Lstat(dir); err == nil || *dryRun {
+		return func() {}
+	}
+	partialDirs.Lock()
+	partialDirs.dirs[dir] = true
+	partialDirs.Unlock()
+	return func() {
+		partialDirs.Lock()
+		delete(partialDirs.dirs, dir)
+		partialDirs.Unlock()
+	}
+}
+
+// removePartialDirs removes the directories still being created.
+func removePartialDirs() {
+	partialDirs.Lock()
+	defer partialDirs.Unlock()
+	for dir := range partialDirs.dirs {
+		warnf("removing the partially fetched %s\n", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			warnf("failed to remove %s: %v\n", dir, err)
+		}
+		delete(partialDirs.dirs, dir)
+	}
+}
+
+var abortOnce sync.Once
+
+// abort exits gom after an interruption, once its partial directories are
+// removed. Whoever calls it second waits for the first to exit.
+func abort() {
+	abortOnce.Do(func() {
+		removePartialDirs()
+		resetColor()
+		os.Exit(interruptedStatus())
+	})
+}
+
+// handleSignal kills the running commands on SIGINT, SIGTERM or SIGHUP, as
+// when the terminal is closed, and exits once they are gone, without leaving
+// half fetched goms behind. A second signal exits right away.
+func handleSignal() {
+	sc := make(chan os.Signal, 10)
+	signal.Notify(sc, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		sig := <-sc
+		if n, ok := sig.(syscall.Signal); ok {
+			atomic.StoreInt32(&interruptSignal, int32(n))
+		}
+		interrupt()
+		go func() {
+			<-sc
+			resetColor()
+			os.Exit(interruptedStatus())
+		}()
+		// The killed commands get five seconds to let go of their output.
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&running) > 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		abort()
+	}()
+}
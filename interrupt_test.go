@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterrupt(t *testing.T) {
+	oldInterrupted, oldInterrupt := interrupted, interrupt
+	defer func() { interrupted, interrupt = oldInterrupted, oldInterrupt }()
+	interrupted, interrupt = context.WithCancel(context.Background())
+
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if p := fetchDir(dir, "github.com/mattn/go-sqlite3/sqlite3/v2"); p != filepath.Join(dir, "src", "github.com", "mattn", "go-sqlite3") {
+		t.Fatalf("Expected %v, but %v:", filepath.Join(dir, "src", "github.com", "mattn", "go-sqlite3"), p)
+	}
+
+	// Only the directories created and not complete yet are removed.
+	existing := filepath.Join(dir, "existing")
+	err = os.Mkdir(existing, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	complete := filepath.Join(dir, "complete")
+	partial := filepath.Join(dir, "partial")
+	creating(existing)
+	done := creating(complete)
+	creating(partial)
+	for _, p := range []string{complete, partial} {
+		err = os.Mkdir(p, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	done()
+
+	cmd, finish := timedCommand(0, "", []string{"sleep", "10"})
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupt()
+	start := time.Now()
+	err = finish(cmd.Wait())
+	var ie *InterruptedError
+	if !errors.As(err, &ie) {
+		t.Fatalf("Expected %v, but %v:", &InterruptedError{[]string{"sleep", "10"}}, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected sleep to be killed, but it ran %v", time.Since(start))
+	}
+
+	removePartialDirs()
+	for p, expected := range map[string]bool{existing: true, complete: true, partial: false} {
+		if isDir(p) != expected {
+			t.Fatalf("Expected %v to exist: %v", p, expected)
+		}
+	}
+}
+
+func TestInterruptedStatus(t *testing.T) {
+	defer atomic.StoreInt32(&interruptSignal, 0)
+	for _, c := range []struct {
+		sig      syscall.Signal
+		expected int
+	}{
+		{0, exitInterrupted},
+		{syscall.SIGINT, 130},
+		{syscall.SIGTERM, 143},
+		{syscall.SIGHUP, 129},
+	} {
+		atomic.StoreInt32(&interruptSignal, int32(c.sig))
+		if status := interruptedStatus(); status != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, status)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// constraintKeys are the options gom list reports for each gom.
+var constraintKeys = []string{"branch", "tag", "commit", "ref", "group"}
+
+type listEntry struct {
+	Name        string            `json:"name"`
+	Constraints map[string]string `json:"constraints,omitempty"`
+	VCS         string            `json:"vcs,omitempty"`
+	Revision    string            `json:"revision,omitempty"`
+	Orphaned    bool              `json:"orphaned,omitempty"`
+}
+
+// vendoredRepos returns the import paths of the repository roots found
+// below the src directory of vendor.
+func vendoredRepos(vendor string) ([]string, error) {
+	src := filepath.Join(vendor, "src")
+	repos := make([]string, 0)
+	if !isDir(src) {
+		return repos, nil
+	}
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || p == src {
+			return nil
+		}
+		if detectVCS(p) != nil {
+			rel, err := filepath.Rel(src, p)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return repos, err
+}
+
+// declares returns true if repo holds, or is held by, the code of one of
+// goms.
+func declares(goms []Gom, repo string) bool {
+	for _, gom := range goms {
+		for _, name := range []string{gom.name, getTarget(&gom)} {
+			if name == repo || strings.HasPrefix(name, repo+"/") || strings.HasPrefix(repo, name+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatOption(v interface{}) string {
+	if a, ok := v.([]string); ok {
+		return strings.Join(a, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the list as JSON")
+	fs.Parse(args)
+
+	goms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]listEntry, 0)
+	for _, gom := range goms {
+		entry := listEntry{Name: gom.name, Constraints: map[string]string{}}
+		for _, key := range constraintKeys {
+			if v, ok := gom.options[key]; ok {
+				entry.Constraints[key] = formatOption(v)
+			}
+		}
+		if vcs := gom.vcs(vendor); vcs != nil {
+			entry.VCS = vcs.name
+			entry.Revision, _ = vcs.Revision(gom.dir(vendor))
+		}
+		entries = append(entries, entry)
+	}
+
+	orphans, err := orphanedRepos(vendor)
+	if err != nil {
+		return err
+	}
+	for _, repo := range orphans {
+		entries = append(entries, listEntry{Name: repo, Orphaned: true})
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	for _, entry := range entries {
+		if entry.Orphaned {
+			fmt.Printf("%s (orphaned)\n", entry.Name)
+			continue
+		}
+		line := entry.Name
+		for _, key := range constraintKeys {
+			if v, ok := entry.Constraints[key]; ok {
+				line += fmt.Sprintf(" %s=%s", key, v)
+			}
+		}
+		if entry.Revision != "" {
+			line += " " + entry.Revision
+		} else {
+			line += " (not installed)"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
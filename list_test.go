@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVendoredRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, p := range []string{
+		"src/github.com/mattn/go-sqlite3/.git",
+		"src/github.com/mattn/go-sqlite3/sub/.git",
+		"src/code.google.com/p/go.net/.hg",
+		"src/github.com/mattn/empty",
+	} {
+		err = os.MkdirAll(filepath.Join(dir, filepath.FromSlash(p)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	repos, err := vendoredRepos(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"code.google.com/p/go.net", "github.com/mattn/go-sqlite3"}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, repos)
+	}
+
+	goms := []Gom{{name: "github.com/mattn/go-sqlite3/sqlite3", options: map[string]interface{}{}}}
+	if !declares(goms, "github.com/mattn/go-sqlite3") {
+		t.Fatal("Expected github.com/mattn/go-sqlite3 to be declared")
+	}
+	if declares(goms, "code.google.com/p/go.net") {
+		t.Fatal("Expected code.google.com/p/go.net to be orphaned")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const lockfile = "Gomfile.lock"
+
+// lockfilePath returns the lockfile of the Gomfile given with -gomfile, its
+// name with .lock appended, or else Gomfile.lock.
+func lockfilePath() string {
+	if *gomfileFlag != "" && *gomfileFlag != stdinGomfile {
+		return *gomfileFlag + ".lock"
+	}
+	return lockfile
+}
+
+// lock is a single line of Gomfile.lock: the exact revision a gom was
+// resolved to, the VCS that revision belongs to, and the pin of the gom in
+// the Gomfile it was resolved from, as gomPin formats it. The pin is "" in
+// the lock files written before it was recorded.
+type lock struct {
+	name     string
+	vcs      string
+	revision string
+	pin      string
+}
+
+// pinKinds are the options pinning a gom to a revision.
+var pinKinds = []string{"branch", "tag", "commit", "ref"}
+
+// gomPin returns the pin of gom as Gomfile.lock records it: kind=value, the
+// value escaped so a constraint with spaces stays one field, or - if it
+// isn't pinned.
+func gomPin(gom *Gom) string {
+	for _, kind := range pinKinds {
+		if v, ok := gom.options[kind].(string); ok {
+			return kind + "=" + url.QueryEscape(v)
+		}
+	}
+	return "-"
+}
+
+// describePin returns the pin as gomPin formats it in words.
+func describePin(pin string) string {
+	i := strings.Index(pin, "=")
+	if i < 0 {
+		return "nothing"
+	}
+	kind, value := pin[:i], pin[i+1:]
+	if v, err := url.QueryUnescape(value); err == nil {
+		value = v
+	}
+	return kind + " " + value
+}
+
+func parseLockfile(filename string) ([]lock, error) {
+	records, err := readRecords(filename, 3, 4)
+	if err != nil {
+		return nil, err
+	}
+	locks := make([]lock, 0)
+	for _, r := range records {
+		l := lock{r[0], r[1], r[2], ""}
+		if len(r) == 4 {
+			l.pin = r[3]
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+func writeLockfile(filename string, locks []lock) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Generated by gom lock. Do not edit.")
+	for _, l := range locks {
+		if l.pin != "" {
+			fmt.Fprintf(w, "%s %s %s %s\n", l.name, l.vcs, l.revision, l.pin)
+		} else {
+			fmt.Fprintf(w, "%s %s %s\n", l.name, l.vcs, l.revision)
+		}
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// applyLocks pins each gom that has an entry in locks to the locked
+// revision, overriding any branch, tag, commit or ref given in the Gomfile.
+// The goms that aren't checked out, like local ones, are left as they are,
+// and so are those pinned to something else than when they were locked.
+func applyLocks(goms []Gom, locks []lock) {
+	for _, l := range locks {
+		found := false
+		for _, gom := range goms {
+			if gom.name != l.name {
+				continue
+			}
+			found = true
+			if _, ok := gom.localPath(); ok || gom.isRelease() {
+				continue
+			}
+			if pin := gomPin(&gom); l.pin != "" && l.pin != pin {
+				warnf("%s is pinned to %s but was locked for %s, ignoring %s for it, run gom lock\n", gom.name, describePin(pin), describePin(l.pin), lockfilePath())
+				continue
+			}
+			delete(gom.options, "branch")
+			delete(gom.options, "tag")
+			delete(gom.options, "ref")
+			gom.options["commit"] = l.revision
+		}
+		if !found {
+			warnf("%s is locked in %s but not in Gomfile\n", l.name, lockfilePath())
+		}
+	}
+}
+
+// staleLocks describes each difference between the goms of the Gomfile and
+// locks: a gom that isn't locked, a lock for a gom that is gone, a branch,
+// tag, commit or ref in the Gomfile other than the one it was locked for, and
+// a commit in the Gomfile that isn't the locked one.
+func staleLocks(goms []Gom, locks []lock) []string {
+	problems := make([]string, 0)
+	for _, gom := range goms {
+		if _, ok := gom.localPath(); ok || gom.isRelease() {
+			continue
+		}
+		var locked *lock
+		for i := range locks {
+			if locks[i].name == gom.name {
+				locked = &locks[i]
+				break
+			}
+		}
+		if locked == nil {
+			problems = append(problems, fmt.Sprintf("%s isn't locked", gom.name))
+			continue
+		}
+		if pin := gomPin(&gom); locked.pin != "" && locked.pin != pin {
+			problems = append(problems, fmt.Sprintf("%s is pinned to %s but was locked for %s", gom.name, describePin(pin), describePin(locked.pin)))
+		} else if commit, ok := gom.options["commit"].(string); ok && !strings.HasPrefix(locked.revision, commit) {
+			problems = append(problems, fmt.Sprintf("%s is pinned to %s but locked to %s", gom.name, commit, locked.revision))
+		}
+	}
+	for _, l := range locks {
+		found := false
+		for _, gom := range goms {
+			if gom.name == l.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s is locked but not in Gomfile", l.name))
+		}
+	}
+	return problems
+}
+
+func genLockfile() error {
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	locks := make([]lock, 0)
+	for _, gom := range filterGoms(allGoms) {
+		if _, ok := gom.localPath(); ok || gom.isRelease() {
+			continue
+		}
+		vcs := gom.vcs(vendor)
+		if vcs == nil {
+			return fmt.Errorf("%s is not installed, run gom install first", gom.name)
+		}
+		revision, err := vcs.Revision(gom.dir(vendor))
+		if err != nil {
+			return err
+		}
+		locks = append(locks, lock{gom.name, vcs.name, revision, gomPin(&gom)})
+	}
+	return writeLockfile(lockfilePath(), locks)
+}
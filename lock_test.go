@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLockfile(t *testing.T) {
+	filename, err := tempGomfile(`
+# Generated by gom lock. Do not edit.
+github.com/mattn/go-sqlite3 git 8897bf145272af4dd0305518bfe2800ae1e7e0b7
+launchpad.net/gocheck bzr 87
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	locks, err := parseLockfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lock{
+		{"github.com/mattn/go-sqlite3", "git", "8897bf145272af4dd0305518bfe2800ae1e7e0b7", ""},
+		{"launchpad.net/gocheck", "bzr", "87", ""},
+	}
+	if !reflect.DeepEqual(locks, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, locks)
+	}
+
+	err = writeLockfile(filename, locks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locks, err = parseLockfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(locks, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, locks)
+	}
+}
+
+func TestLockfileSyntaxError(t *testing.T) {
+	filename, err := tempGomfile(`
+github.com/mattn/go-sqlite3 git
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	_, err = parseLockfile(filename)
+	if err == nil {
+		t.Fatal("Expected syntax error")
+	}
+}
+
+func TestApplyLocks(t *testing.T) {
+	goms := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"branch": "master"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1"}},
+		{name: "github.com/mattn/go-local", options: map[string]interface{}{"path": "../go-local"}},
+	}
+	applyLocks(goms, []lock{
+		{"github.com/mattn/go-sqlite3", "git", "8897bf145272af4dd0305518bfe2800ae1e7e0b7", ""},
+		{"github.com/mattn/go-local", "git", "36f63b8223e701c16f36010094fb6e84ffbaf8e0", ""},
+		{"github.com/mattn/go-runewidth", "git", "36f63b8223e701c16f36010094fb6e84ffbaf8e0", ""},
+	})
+	expected := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"commit": "8897bf145272af4dd0305518bfe2800ae1e7e0b7"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"tag": "v1"}},
+		{name: "github.com/mattn/go-local", options: map[string]interface{}{"path": "../go-local"}},
+	}
+	if !reflect.DeepEqual(goms, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, goms)
+	}
+}
+
+func TestStaleLocks(t *testing.T) {
+	goms := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"commit": "8897bf1"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{"commit": "3c2a8e1"}},
+		{name: "github.com/mattn/go-colorable", options: map[string]interface{}{}},
+		{name: "github.com/mattn/go-local", options: map[string]interface{}{"path": "../go-local"}},
+	}
+	locks := []lock{
+		{"github.com/mattn/go-sqlite3", "git", "8897bf145272af4dd0305518bfe2800ae1e7e0b7", ""},
+		{"github.com/mattn/go-gtk", "git", "36f63b8223e701c16f36010094fb6e84ffbaf8e0", ""},
+		{"github.com/mattn/go-runewidth", "git", "36f63b8223e701c16f36010094fb6e84ffbaf8e0", ""},
+	}
+	expected := []string{
+		"github.com/mattn/go-gtk is pinned to 3c2a8e1 but locked to 36f63b8223e701c16f36010094fb6e84ffbaf8e0",
+		"github.com/mattn/go-colorable isn't locked",
+		"github.com/mattn/go-runewidth is locked but not in Gomfile",
+	}
+	problems := staleLocks(goms, locks)
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, problems)
+	}
+	if problems := staleLocks(goms[:1], locks[:1]); len(problems) != 0 {
+		t.Fatalf("Expected no problems, but %v:", problems)
+	}
+}
+
+func TestLockfilePins(t *testing.T) {
+	filename, err := tempGomfile(`
+github.com/mattn/go-sqlite3 git 8897bf145272af4dd0305518bfe2800ae1e7e0b7 tag=v1.14.0
+github.com/mattn/go-gtk git 3c2a8e1dbb8dd9b6a469ed34b8fb7f6d69f0258e -
+launchpad.net/gocheck bzr 87
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(filename)
+	locks, err := parseLockfile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lock{
+		{"github.com/mattn/go-sqlite3", "git", "8897bf145272af4dd0305518bfe2800ae1e7e0b7", "tag=v1.14.0"},
+		{"github.com/mattn/go-gtk", "git", "3c2a8e1dbb8dd9b6a469ed34b8fb7f6d69f0258e", "-"},
+		{"launchpad.net/gocheck", "bzr", "87", ""},
+	}
+	if !reflect.DeepEqual(locks, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, locks)
+	}
+
+	// A constraint stays one field.
+	gom := Gom{name: "github.com/mattn/go-runewidth", options: map[string]interface{}{"tag": ">=1.2.0 <2.0.0"}}
+	if pin := gomPin(&gom); pin != "tag=%3E%3D1.2.0+%3C2.0.0" || describePin(pin) != "tag >=1.2.0 <2.0.0" {
+		t.Fatalf("Expected %v, but %v:", "tag=%3E%3D1.2.0+%3C2.0.0", pin)
+	}
+}
+
+func TestStaleLockPins(t *testing.T) {
+	locks := []lock{
+		{"github.com/mattn/go-sqlite3", "git", "8897bf145272af4dd0305518bfe2800ae1e7e0b7", "tag=v1.14.0"},
+		{"github.com/mattn/go-gtk", "git", "36f63b8223e701c16f36010094fb6e84ffbaf8e0", "-"},
+	}
+	goms := []Gom{
+		{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"tag": "v1.14.0"}},
+		{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}},
+	}
+	if problems := staleLocks(goms, locks); len(problems) != 0 {
+		t.Fatalf("Expected no problems, but %v:", problems)
+	}
+
+	// The tag changed in the Gomfile, but the lock still has the old commit.
+	goms[0].options["tag"] = "v1.14.1"
+	goms[1].options["branch"] = "master"
+	expected := []string{
+		"github.com/mattn/go-sqlite3 is pinned to tag v1.14.1 but was locked for tag v1.14.0",
+		"github.com/mattn/go-gtk is pinned to branch master but was locked for nothing",
+	}
+	problems := staleLocks(goms, locks)
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, problems)
+	}
+
+	// Nor does install check the old commit out.
+	applyLocks(goms, locks)
+	if !reflect.DeepEqual(goms[0].options, map[string]interface{}{"tag": "v1.14.1"}) {
+		t.Fatalf("Expected %v, but %v:", map[string]interface{}{"tag": "v1.14.1"}, goms[0].options)
+	}
+}
+
+func TestWriteLockfileError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	// The write only fails once what was written is flushed.
+	err := writeLockfile("/dev/full", []lock{{name: "github.com/mattn/go-runewidth", vcs: "git", revision: "14e809f6d3f5"}})
+	if err == nil {
+		t.Fatalf("Expected the full device to fail the write, but nil:")
+	}
+}
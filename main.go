@@ -3,78 +3,248 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/daviddengcn/go-colortext"
 	"os"
+	"runtime"
+	"time"
 )
 
 func usage() {
 	fmt.Printf(`Usage of %s:
  Tasks:
    gom build   [options]   : Build with _vendor packages
-   gom install [options]   : Install bundled packages into _vendor directory, by default.
-                              GOM_VENDOR_NAME=. gom install [options], for regular src folder.
-   gom test    [options]   : Run tests with bundles
+   gom rebuild [options]   : Build and install the bundles again, without
+                              fetching them
+   gom update  [packages]  : Fetch the latest revisions of the given bundles,
+                              or all of them, within their Gomfile constraints
+   gom install [options] [packages]
+                           : Install bundled packages into _vendor directory, by default.
+                              GOM_VENDOR=. gom install [options], for regular src folder.
+                              Only the given bundles, if any.
+   gom test    [options]   : Run tests with bundles, of ./... by default
    gom run     [options]   : Run go file with bundles
    gom doc     [options]   : Run godoc for bundles
-   gom exec    [arguments] : Execute command with bundle environment
+   gom exec    [--] [arguments]
+                           : Execute command with bundle environment
+   gom outdated [-security]
+                           : Show the bundles pinned to a branch or tag that
+                              have newer revisions or tags upstream, and with
+                              -security those with known vulnerabilities
+   gom list    [-json]     : List bundles with their constraints and installed
+                              revisions, and flag orphaned _vendor packages
+   gom status              : Show the _vendor packages with local changes, or
+                              checked out at another revision than pinned
+   gom why     <package>   : Show the chain of imports from a Gomfile bundle
+                              that brought a package into _vendor
+   gom cat     <package>   : Show the options in effect for a bundle, after its
+                              lock and the host defaults, and where each is from
+   gom graph   [-depth N]  : Print the imports of the _vendor packages from
+                              the Gomfile bundles as a Graphviz DOT graph
+   gom clean   [-dry-run]  : Remove _vendor packages that are neither in
+                              Gomfile nor imported by one that is
+   gom prune   [-tests] [-vcs] [-keep patterns]
+                           : Remove the files of _vendor packages that aren't
+                              needed to build them
+   gom vendor-commit [-dry-run]
+                           : Record the revision of each _vendor package and
+                              remove their version control directories
+   gom add     <package> [-tag X | -branch Y | -commit Z] [-group G]
+                           : Add a bundle to Gomfile, or update its options
+   gom edit    <package> [-patch file]
+                           : Put a _vendor package on a branch to change it, or
+                              record its changes as a patch in Gomfile
+   gom remove  <package> [-group G] [-prune]
+                           : Remove a bundle from Gomfile, and with -prune
+                              from _vendor directory
+   gom doctor  [options]   : Clone again and install the bundles whose checkouts
+                              are corrupt, e.g. after an interrupted clone
+   gom check               : Validate Gomfile, reporting unknown options,
+                              conflicting versions and duplicate bundles
+   gom lock                : Record the revision of each installed bundle
+                              into Gomfile.lock
+   gom modules [module]    : Generate go.mod requiring the bundles at their
+                              Gomfile or installed revisions
+   gom cache-key [options] : Print the hash of Gomfile.lock, the bundles and
+                              the flags installing them, which -vendor-cache
+                              archives _vendor under
+   gom version [-deps]     : Print the versions of gom and Go and the GOPATH,
+                              and with -deps the revision of each bundle
+   gom self-update [-check]
+                           : Replace gom with its latest release, or only
+                              report whether there is a newer one
+   gom import-dep [dir]    : Generate Gomfile and Gomfile.lock from the
+                              Gopkg.toml and Gopkg.lock of dep
    gom gen travis-yml      : Generate .travis.yml which uses "gom test"
-   gom gen gomfile         : Scan packages from current directory as root
-                              recursively, and generate Gomfile
+   gom gen [gomfile]       : Scan packages from current directory as root
+                              recursively, and generate Gomfile with the
+                              repositories they import
+ Options:
 `, os.Args[0])
+	flag.PrintDefaults()
 	os.Exit(1)
 }
 
 var productionEnv = flag.Bool("production", false, "production environment")
 var developmentEnv = flag.Bool("development", false, "development environment")
 var testEnv = flag.Bool("test", false, "test environment")
+var groupsFlag = flag.String("groups", "", "comma separated groups to install, instead of the environment ones")
+var withoutFlag = flag.String("without", "", "comma separated groups not to install")
+var dryRun = flag.Bool("dry-run", false, "print the commands that would be run instead of running them")
+var force = flag.Bool("force", false, "fetch and check out every bundle again, even those already at their pinned commit or tag, and let self-update replace a development build")
+var repair = flag.Bool("repair", false, "clone the bundles whose checkouts are corrupt again when installing")
+var noLock = flag.Bool("no-lock", false, "ignore Gomfile.lock when installing")
+var frozen = flag.Bool("frozen", false, "fail install without fetching anything if Gomfile.lock is out of date")
+var netrcFile = flag.String("netrc", "", "authenticate private HTTPS clones with this .netrc file instead of ~/.netrc")
+var shallow = flag.Bool("shallow", false, "clone private git repositories with a history depth of 1")
+var retries = flag.Int("retries", 3, "number of times to retry a fetch failing with a network error")
+var updateChecksums = flag.Bool("update-checksums", false, "record changed checksums in Gomfile.sum instead of failing")
+var offline = flag.Bool("offline", false, "install from _vendor and the cache only, without fetching anything")
+var cacheFlag = flag.String("cache", "", "directory to cache fetched repositories in, overriding GOM_CACHE (default \"~/.gom/cache\")")
+var readOnly = flag.Bool("read-only", false, "make _vendor/src read-only once install is done, so builds can't change it")
+var vendorCache = flag.String("vendor-cache", "", "directory install restores _vendor from, or archives it to, by the hash of Gomfile.lock")
+var noCache = flag.Bool("no-cache", false, "don't share fetched repositories across projects through $GOM_CACHE")
+var jobs = flag.Int("j", runtime.NumCPU(), "number of dependencies to fetch, and build, in parallel")
+var gitJobs = flag.Int("git-jobs", 0, "number of remotes and submodules each git clone or fetch fetches in parallel, 0 for git's default")
+var buildTags = flag.String("tags", "", "build tags to build the bundles with, like go build -tags")
+var timeout = flag.Duration("timeout", 10*time.Minute, "kill a fetch, checkout or build command running longer than this, 0 for no limit")
+var goFlag = flag.String("go", "", "go command to fetch, build and test with, overriding GOM_GO (default \"go\")")
+var gomfileFlag = flag.String("gomfile", "", "Gomfile to read, or - for stdin (default \"Gomfile.toml\" or \"Gomfile\")")
+var vendorFlag = flag.String("vendor", "", "vendor directory, overriding GOM_VENDOR (default \"_vendor\")")
+var noColor = flag.Bool("no-color", false, "don't color the output, as when it isn't a terminal")
+var verbose = flag.Bool("v", false, "print each command before running it")
+var quiet = flag.Bool("q", false, "only print warnings and errors, not the progress of each step")
+var output = flag.String("output", "human", "progress output of install, human or json (one object per step, on stdout)")
 var vendorFolder string
 
+func init() {
+	flag.BoolVar(verbose, "verbose", false, "same as -v")
+	flag.BoolVar(quiet, "quiet", false, "same as -q")
+}
+
 func main() {
 	flag.Usage = usage
+	if err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "gom: ", err)
+		os.Exit(1)
+	}
 	flag.Parse()
 	if flag.NArg() == 0 {
 		usage()
 	}
 	handleSignal()
+	if *verbose && *quiet {
+		fmt.Fprintln(os.Stderr, "gom:  -v and -q can't be used together")
+		os.Exit(1)
+	}
+	if err := setOutput(*output, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gom: ", err)
+		os.Exit(1)
+	}
+	useColor = !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(stdout)
+	ct.Writer = stdout
 
 	if !*productionEnv && !*developmentEnv && !*testEnv {
 		*developmentEnv = true
 	}
 
-	if len(os.Getenv("GOM_VENDOR_NAME")) > 0 {
+	switch {
+	case len(*vendorFlag) > 0:
+		vendorFolder = *vendorFlag
+	case len(os.Getenv("GOM_VENDOR")) > 0:
+		vendorFolder = os.Getenv("GOM_VENDOR")
+	case len(os.Getenv("GOM_VENDOR_NAME")) > 0:
 		vendorFolder = os.Getenv("GOM_VENDOR_NAME")
-	} else {
+	default:
 		vendorFolder = "_vendor"
 	}
 
 	var err error
 	subArgs := flag.Args()[1:]
+	if writesVendor[flag.Arg(0)] {
+		err = unlockVendor()
+		if err != nil {
+			printError(err)
+			os.Exit(exitCode(err))
+		}
+	}
 	switch flag.Arg(0) {
 	case "install", "i":
 		err = install(subArgs)
+	case "update", "u":
+		err = update(subArgs)
 	case "build", "b":
-		err = run(append([]string{"go", "build"}, subArgs...), None)
+		err = userCommand(run(append([]string{goCommand(), "build"}, subArgs...), None))
+	case "rebuild":
+		err = rebuild(subArgs)
 	case "test", "t":
-		err = run(append([]string{"go", "test"}, subArgs...), None)
+		err = userCommand(test(subArgs))
 	case "run", "r":
-		err = run(append([]string{"go", "run"}, subArgs...), None)
+		err = userCommand(run(append([]string{goCommand(), "run"}, subArgs...), None))
 	case "doc", "d":
-		err = run(append([]string{"godoc"}, subArgs...), None)
+		err = userCommand(run(append([]string{"godoc"}, subArgs...), None))
 	case "exec", "e":
-		err = run(subArgs, None)
+		if len(subArgs) > 0 && subArgs[0] == "--" {
+			subArgs = subArgs[1:]
+		}
+		err = userCommand(run(subArgs, None))
+	case "outdated":
+		err = outdated(subArgs)
+	case "list":
+		err = list(subArgs)
+	case "status":
+		err = status()
+	case "why":
+		err = why(subArgs)
+	case "cat":
+		err = cat(subArgs)
+	case "edit":
+		err = edit(subArgs)
+	case "graph":
+		err = graph(subArgs)
+	case "clean":
+		err = clean(subArgs)
+	case "prune":
+		err = prune(subArgs)
+	case "vendor-commit":
+		err = vendorCommit(subArgs)
+	case "add":
+		err = add(subArgs)
+	case "remove":
+		err = remove(subArgs)
+	case "doctor":
+		err = doctor(subArgs)
+	case "check":
+		err = check()
+	case "lock", "l":
+		err = genLockfile()
+	case "version":
+		err = printVersion(subArgs)
+	case "self-update":
+		err = selfUpdate(subArgs)
+	case "cache-key":
+		err = cacheKey(subArgs)
+	case "modules":
+		err = genGoMod(subArgs)
+	case "import-dep":
+		err = importDep(subArgs)
 	case "gen", "g":
-		switch flag.Arg(1) {
-		case "travis-yml":
-			err = genTravisYml()
-		case "gomfile":
-			err = genGomfile()
-		default:
+		generate := generator(flag.Arg(1))
+		if generate == nil {
 			usage()
 		}
+		err = generate()
 	default:
 		usage()
 	}
+	// What gom edit has made editable is left so.
+	if err == nil && *readOnly && writesVendor[flag.Arg(0)] && flag.Arg(0) != "edit" && !*dryRun {
+		err = lockVendor()
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "gom: ", err)
-		os.Exit(1)
+		printError(err)
+		if interrupted.Err() != nil {
+			abort()
+		}
+		os.Exit(exitCode(err))
 	}
 }
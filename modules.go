@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const gomod = "go.mod"
+
+var re_major = regexp.MustCompile(`/v(\d+)$`)
+var re_goVersion = regexp.MustCompile(`^1\.\d+`)
+
+// semver returns tag as a module version of path, or "" if tag isn't a
+// semantic version in full, with its minor and patch numbers.
+func semver(path, tag string) string {
+	m := re_version.FindStringSubmatch(tag)
+	if m == nil || m[2] == "" || m[3] == "" {
+		return ""
+	}
+	version := tag
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	major, _ := strconv.Atoi(m[1])
+	if major >= 2 {
+		pm := re_major.FindStringSubmatch(path)
+		if pm == nil || pm[1] != m[1] {
+			version += "+incompatible"
+		}
+	}
+	return version
+}
+
+// pseudoVersion returns the v0.0.0 pseudo-version of a commit made at t.
+func pseudoVersion(t time.Time, commit string) string {
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("v0.0.0-%s-%s", t.UTC().Format("20060102150405"), commit)
+}
+
+// gitCommit returns the hash and commit time of the git revision rev in
+// dir.
+func gitCommit(dir, rev string) (string, time.Time, error) {
+	cmd := exec.Command("git", "log", "-1", "--format=%H %ct", rev)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	items := strings.Fields(string(out))
+	if len(items) != 2 {
+		return "", time.Time{}, fmt.Errorf("unexpected output of git log: %q", out)
+	}
+	sec, err := strconv.ParseInt(items[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return items[0], time.Unix(sec, 0), nil
+}
+
+// moduleVersion maps the version options of gom, or the revision vendored
+// for it, to a module version. When no canonical version can be computed,
+// the raw revision is returned with ok set to false; the go command
+// resolves those on its next run.
+func moduleVersion(gom *Gom, vendor string) (version string, ok bool) {
+	rev := ""
+	for _, key := range []string{"branch", "tag", "commit"} {
+		if v, found := gom.options[key].(string); found {
+			rev = v
+		}
+	}
+	if tag, found := gom.options["tag"].(string); found && tag == rev {
+		if v := semver(gom.name, tag); v != "" {
+			return v, true
+		}
+	}
+	if gom.vcs(vendor) == git {
+		r := rev
+		if r == "" {
+			r = "HEAD"
+		}
+		hash, t, err := gitCommit(gom.dir(vendor), r)
+		if err == nil {
+			return pseudoVersion(t, hash), true
+		}
+	}
+	if rev == "" {
+		rev = "latest"
+	}
+	return rev, false
+}
+
+// modulePath guesses the module path of the current directory from its
+// location in GOPATH.
+func modulePath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for _, p := range filepath.SplitList(os.Getenv("GOPATH")) {
+		rel, err := filepath.Rel(filepath.Join(p, "src"), cwd)
+		if err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	return "", errors.New("can't determine the module path outside of GOPATH, give it as an argument")
+}
+
+func genGoMod(args []string) error {
+	_, err := os.Stat(gomod)
+	if err == nil {
+		return errors.New("go.mod already exists")
+	}
+	var module string
+	if len(args) > 0 {
+		module = args[0]
+	} else {
+		module, err = modulePath()
+		if err != nil {
+			return err
+		}
+	}
+
+	allGoms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(gomod)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "module %s\n\n", module)
+	if v := re_goVersion.FindString(strings.TrimPrefix(runtime.Version(), "go")); v != "" {
+		fmt.Fprintf(f, "go %s\n\n", v)
+	}
+
+	replaces := make([]string, 0)
+	fmt.Fprintln(f, "require (")
+	for _, gom := range allGoms {
+		if gom.isRelease() {
+			warnf("%s comes from a release artifact, leaving it out of %s\n", gom.name, gomod)
+			continue
+		}
+		version, ok := moduleVersion(&gom, vendor)
+		if !ok {
+			warnf("%s has no canonical version, run go mod tidy to resolve %s\n", gom.name, version)
+		}
+		fmt.Fprintf(f, "\t%s %s\n", getTarget(&gom), version)
+		if local, ok := gom.localPath(); ok {
+			if !filepath.IsAbs(local) && !strings.HasPrefix(local, ".") {
+				// Otherwise it would be taken for a module path.
+				local = "./" + local
+			}
+			replaces = append(replaces, fmt.Sprintf("%s => %s", getTarget(&gom), local))
+		} else if fork, ok := gom.options["fork"].(string); ok {
+			replaces = append(replaces, fmt.Sprintf("%s => %s %s", getTarget(&gom), fork, version))
+		} else if replace, ok := gom.options["replace"].(string); ok && !strings.Contains(replace, "://") {
+			replaces = append(replaces, fmt.Sprintf("%s => %s %s", getTarget(&gom), replace, version))
+		}
+	}
+	fmt.Fprintln(f, ")")
+	for _, r := range replaces {
+		fmt.Fprintf(f, "\nreplace %s\n", r)
+	}
+	return nil
+}
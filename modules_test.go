@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemver(t *testing.T) {
+	for _, c := range []struct {
+		path, tag, expected string
+	}{
+		{"github.com/mattn/go-sqlite3", "v1.2.3", "v1.2.3"},
+		{"github.com/mattn/go-sqlite3", "1.2.3", "v1.2.3"},
+		{"github.com/mattn/go-sqlite3", "v1.2.3-rc1", "v1.2.3-rc1"},
+		{"github.com/mattn/go-sqlite3", "v2.0.0", "v2.0.0+incompatible"},
+		{"github.com/mattn/go-sqlite3/v2", "v2.0.0", "v2.0.0"},
+		{"github.com/mattn/go-runewidth", "go1", ""},
+		{"github.com/mattn/go-runewidth", "release-1.2", ""},
+	} {
+		if s := semver(c.path, c.tag); s != c.expected {
+			t.Fatalf("Expected %q for %s %s, but %q:", c.expected, c.path, c.tag, s)
+		}
+	}
+}
+
+func TestPseudoVersion(t *testing.T) {
+	commit := "ecb144fb1f2848a24ebfdadf8e64380406d87206"
+	tm := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)
+	expected := "v0.0.0-20140304050607-ecb144fb1f28"
+	if s := pseudoVersion(tm, commit); s != expected {
+		t.Fatalf("Expected %v, but %v:", expected, s)
+	}
+}
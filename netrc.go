@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// netrcMachine is an entry of a .netrc file. The default entry has no name.
+type netrcMachine struct {
+	name     string
+	login    string
+	password string
+}
+
+// parseNetrc reads the machines of the .netrc file filename, as curl and
+// so git understand it.
+func parseNetrc(filename string) ([]netrcMachine, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	machines := make([]netrcMachine, 0)
+	var m *netrcMachine
+	lines := strings.Split(string(b), "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			if strings.HasPrefix(fields[j], "#") {
+				break
+			}
+			value := ""
+			if j+1 < len(fields) {
+				value = fields[j+1]
+			}
+			switch fields[j] {
+			case "machine":
+				machines = append(machines, netrcMachine{name: value})
+				m = &machines[len(machines)-1]
+				j++
+			case "default":
+				machines = append(machines, netrcMachine{})
+				m = &machines[len(machines)-1]
+			case "login", "password", "account":
+				if m != nil && fields[j] == "login" {
+					m.login = value
+				} else if m != nil && fields[j] == "password" {
+					m.password = value
+				}
+				j++
+			case "macdef":
+				// The macro goes on up to an empty line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return machines, nil
+}
+
+// netrcLogin returns the login and password for host in machines, from its
+// own entry or else the default one.
+func netrcLogin(machines []netrcMachine, host string) (string, string, bool) {
+	for _, m := range machines {
+		if m.name == host {
+			return m.login, m.password, true
+		}
+	}
+	for _, m := range machines {
+		if m.name == "" {
+			return m.login, m.password, true
+		}
+	}
+	return "", "", false
+}
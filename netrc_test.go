@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	f, err := ioutil.TempFile("", "netrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`# CI credentials
+machine github.com login ci password s3cr3t
+machine gitlab.com
+  login deploy
+  password t0ken
+macdef init
+  machine evil.example.com login x password y
+
+default login anonymous password guest
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machines, err := parseNetrc(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netrcMachine{
+		{"github.com", "ci", "s3cr3t"},
+		{"gitlab.com", "deploy", "t0ken"},
+		{"", "anonymous", "guest"},
+	}
+	if !reflect.DeepEqual(machines, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, machines)
+	}
+	if login, password, _ := netrcLogin(machines, "gitlab.com"); login != "deploy" || password != "t0ken" {
+		t.Fatalf("Expected %v, but %v:", "deploy", login)
+	}
+	if login, _, _ := netrcLogin(machines, "bitbucket.org"); login != "anonymous" {
+		t.Fatalf("Expected %v, but %v:", "anonymous", login)
+	}
+}
+
+// authServer is an HTTPS server asking for credentials, recording the ones
+// it is given.
+func authServer() (*httptest.Server, func() []string) {
+	var (
+		mu   sync.Mutex
+		auth []string
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gom"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		auth = append(auth, user+":"+password)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, auth...)
+	}
+}
+
+func TestNetrcClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, env := range []string{"HOME", "GIT_SSL_NO_VERIFY", "GIT_TERMINAL_PROMPT", "GOM_GIT_TOKEN"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("HOME", dir)
+	os.Setenv("GIT_SSL_NO_VERIFY", "true")
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+	os.Unsetenv("GOM_GIT_TOKEN")
+	oldRetries := *retries
+	defer func() { *retries = oldRetries }()
+	*retries = 0
+
+	server, auth := authServer()
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	gom := &Gom{name: host + "/mattn/private", options: map[string]interface{}{}}
+
+	// The URL gom clones from has no credentials for ~/.netrc to be used.
+	u, err := url.Parse(privateURL(gom.name, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.User != nil || u.Hostname() != "127.0.0.1" {
+		t.Fatalf("Expected a URL without credentials, but %v:", u)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, ".netrc"), []byte("machine 127.0.0.1 login home password h0me\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gom.clonePrivate(filepath.Join(dir, "clone"), true)
+	if got := auth(); !has(got, "home:h0me") {
+		t.Fatalf("Expected %v, but %v:", "home:h0me", got)
+	}
+
+	netrc := filepath.Join(dir, "ci-netrc")
+	err = ioutil.WriteFile(netrc, []byte("machine 127.0.0.1 login ci password c1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { *netrcFile = "" }()
+	*netrcFile = netrc
+	gom.clonePrivate(filepath.Join(dir, "clone"), true)
+	if got := auth(); !has(got, "ci:c1") {
+		t.Fatalf("Expected %v, but %v:", "ci:c1", got)
+	}
+}
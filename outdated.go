@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+// outdated reports the goms pinned to a branch or tag for which a newer
+// revision or tag is available upstream. Only the repositories are fetched,
+// working trees are left alone. With -security, it then reports the goms
+// installed at a version with known vulnerabilities, and fails if any is.
+func outdated(args []string) error {
+	fs := flag.NewFlagSet("outdated", flag.ExitOnError)
+	security := fs.Bool("security", false, "also look up the installed versions in the Go vulnerability database")
+	fs.Parse(args)
+
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+
+	for _, gom := range filterGoms(allGoms) {
+		branch, hasBranch := gom.options["branch"].(string)
+		tag, hasTag := gom.options["tag"].(string)
+		if _, isLocal := gom.localPath(); isLocal || gom.isRelease() || (!hasBranch && !hasTag) {
+			continue
+		}
+		vcs := gom.vcs(vendor)
+		if vcs == nil {
+			warnf("%s is not installed\n", gom.name)
+			continue
+		}
+		if vcs.resolve == nil {
+			warnf("gom can't check %s repositories without updating them, skipping %s\n", vcs.name, gom.name)
+			continue
+		}
+		p := gom.dir(vendor)
+		err = vcs.Update(p)
+		if err != nil {
+			return err
+		}
+		head, err := vcs.Revision(p)
+		if err != nil {
+			return err
+		}
+
+		if hasTag {
+			tags, err := vcs.Tags(p)
+			if err != nil {
+				return err
+			}
+			newest, err := highestTag(tags, ">=0.0.0")
+			if err != nil {
+				// Not a semantic versioned repository.
+				continue
+			}
+			rev, err := vcs.Resolve(p, newest)
+			if err != nil {
+				return err
+			}
+			if rev != head {
+				fmt.Printf("%s tag %s, newest %s\n", gom.name, tag, newest)
+			}
+			continue
+		}
+
+		latest, err := vcs.Resolve(p, fmt.Sprintf(vcs.remoteBranch, branch))
+		if err != nil {
+			return err
+		}
+		if latest != head {
+			fmt.Printf("%s branch %s at %s, upstream %s\n", gom.name, branch, head, latest)
+		}
+	}
+
+	if *security {
+		n, err := securityReport(filterGoms(allGoms), vendor)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%d bundles have known vulnerabilities", n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd the leader of a new process group, so that the
+// helpers it starts, like git-remote-https or ssh, are killed along with it
+// on timeout. Not when gom runs in a terminal though: a background process
+// group couldn't prompt for passwords there.
+func setProcessGroup(cmd *exec.Cmd) {
+	if isTerminal(os.Stdin) {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// prunedFiles are the patterns of the files pruned from every vendored
+// repository, none of which is needed to build it.
+var prunedFiles = []string{
+	"*.md", "*.mkd", "*.markdown", "*.rst",
+	".gitignore", ".gitattributes", ".travis.yml", "appveyor.yml",
+}
+
+// licenseFiles are the prefixes of the files never pruned, as distributing
+// a repository may require keeping them.
+var licenseFiles = []string{"LICENSE", "LICENCE", "COPYING", "NOTICE", "PATENTS", "AUTHORS"}
+
+type pruneOptions struct {
+	tests bool
+	vcs   bool
+	keep  []string
+}
+
+// kept returns true if the file or directory at rel, a slash separated path
+// below the repository, matches one of the -keep patterns or is a license.
+func (o pruneOptions) kept(rel string) bool {
+	name := path.Base(rel)
+	for _, prefix := range licenseFiles {
+		if strings.HasPrefix(strings.ToUpper(name), prefix) {
+			return true
+		}
+	}
+	for _, pattern := range o.keep {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// prunable returns true if the file or directory at rel isn't needed to
+// build the repository.
+func (o pruneOptions) prunable(rel string, info os.FileInfo) bool {
+	name := info.Name()
+	if isVCSMetadata(name) {
+		return o.vcs
+	}
+	if info.IsDir() {
+		return name == "testdata"
+	}
+	if o.tests && strings.HasSuffix(name, "_test.go") {
+		return true
+	}
+	for _, pattern := range prunedFiles {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneRepo removes the files of the repository in dir that aren't needed
+// to build it, or with onlyPrint prints them, and returns how many there
+// were.
+func pruneRepo(dir string, o pruneOptions, onlyPrint bool) (int, error) {
+	n := 0
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if o.kept(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !o.prunable(rel, info) {
+			if info.IsDir() && isVCSMetadata(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		n++
+		if onlyPrint {
+			fmt.Printf("would remove %s\n", p)
+		} else {
+			tracef("+ rm -r %s\n", p)
+			err = os.RemoveAll(p)
+			if err != nil {
+				return err
+			}
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return n, err
+}
+
+// prunedRepos returns the repositories below vendor to prune: the vendored
+// ones and those of the goms in the Gomfile, whose VCS directory an earlier
+// prune may have removed.
+func prunedRepos(vendor string) ([]string, error) {
+	goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := vendoredRepos(vendor)
+	if err != nil {
+		return nil, err
+	}
+	for _, gom := range goms {
+		target := getTarget(&gom)
+		if repoOf(repos, target) == "" && isDir(gom.dir(vendor)) {
+			repos = append(repos, target)
+		}
+	}
+	return repos, nil
+}
+
+func prune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	onlyPrint := fs.Bool("dry-run", *dryRun, "only print what would be removed")
+	tests := fs.Bool("tests", false, "also remove _test.go files")
+	vcs := fs.Bool("vcs", false, "also remove version control directories")
+	keep := fs.String("keep", "", "comma separated patterns of files to keep")
+	fs.Parse(args)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	repos, err := prunedRepos(vendor)
+	if err != nil {
+		return err
+	}
+	o := pruneOptions{*tests, *vcs, splitGroups(*keep)}
+	for _, repo := range repos {
+		n, err := pruneRepo(filepath.Join(vendor, "src", filepath.FromSlash(repo)), o, *onlyPrint)
+		if err != nil {
+			return err
+		}
+		if n > 0 && !*onlyPrint {
+			progressf("pruned %d files from %s\n", n, repo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPruneRepo(t *testing.T) {
+	for _, c := range []struct {
+		o        pruneOptions
+		expected []string
+	}{
+		{
+			pruneOptions{},
+			[]string{".git/HEAD", "LICENSE.md", "sqlite3.go", "sqlite3_test.go"},
+		},
+		{
+			pruneOptions{tests: true, vcs: true},
+			[]string{"LICENSE.md", "sqlite3.go"},
+		},
+		{
+			pruneOptions{keep: []string{"examples", "test*"}},
+			[]string{".git/HEAD", "LICENSE.md", "examples/README.md", "sqlite3.go", "sqlite3_test.go", "testdata/foo.db"},
+		},
+	} {
+		dir, err := ioutil.TempDir("", "gom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		for _, name := range []string{
+			".git/HEAD", ".gitignore", "LICENSE.md", "README.md", "examples/README.md",
+			"sqlite3.go", "sqlite3_test.go", "testdata/foo.db",
+		} {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			err = os.MkdirAll(filepath.Dir(p), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ioutil.WriteFile(p, []byte(name), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_, err = pruneRepo(dir, c.o, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := make([]string, 0)
+		err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, p)
+			files = append(files, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, files)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// readOnlyMarker records, in the vendor directory, that -read-only made its
+// src tree read-only.
+const readOnlyMarker = ".gom-read-only"
+
+// writesVendor are the tasks changing the vendor src tree, which is made
+// writable again before they run.
+var writesVendor = map[string]bool{
+	"install": true, "i": true, "update": true, "u": true, "outdated": true,
+	"doctor": true, "clean": true, "prune": true, "vendor-commit": true,
+	"edit": true, "remove": true,
+}
+
+// isReadOnlyVendor returns true if -read-only made the src tree of vendor
+// read-only.
+func isReadOnlyVendor(vendor string) bool {
+	return isFile(filepath.Join(vendor, readOnlyMarker))
+}
+
+// chmodTree adds, or removes, the write permissions of the files and
+// directories below dir. Symbolic links and what they point to, like local
+// packages, are left alone. On Windows only files can be read-only, a
+// directory always takes new files.
+func chmodTree(dir string, writable bool) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 || (info.IsDir() && runtime.GOOS == "windows") {
+			return nil
+		}
+		mode := info.Mode().Perm() &^ 0222
+		if writable {
+			mode = info.Mode().Perm() | 0200
+		}
+		if mode == info.Mode().Perm() {
+			return nil
+		}
+		return os.Chmod(p, mode)
+	})
+}
+
+// writablePaths returns the files and directories below dir, relative to
+// it, that are writable although lockVendor made them read-only.
+func writablePaths(dir string) ([]string, error) {
+	paths := make([]string, 0)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 || (info.IsDir() && runtime.GOOS == "windows") {
+			return nil
+		}
+		if info.Mode().Perm()&0222 != 0 {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// lockVendor makes the src tree of the vendor directory read-only, so a
+// build writing into it fails, and records it.
+func lockVendor() error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(vendor, "src")
+	if !isDir(src) {
+		return nil
+	}
+	err = chmodTree(src, false)
+	if err != nil {
+		return err
+	}
+	progressf("made %s read-only\n", src)
+	return ioutil.WriteFile(filepath.Join(vendor, readOnlyMarker), nil, 0644)
+}
+
+// unlockVendor makes the src tree of the vendor directory writable again,
+// if lockVendor made it read-only.
+func unlockVendor() error {
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	if !isReadOnlyVendor(vendor) {
+		return nil
+	}
+	if *dryRun {
+		fmt.Fprintf(stdout, "would make %s writable\n", filepath.Join(vendor, "src"))
+		return nil
+	}
+	tracef("+ chmod -R u+w %s\n", filepath.Join(vendor, "src"))
+	err = chmodTree(filepath.Join(vendor, "src"), true)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(filepath.Join(vendor, readOnlyMarker))
+}
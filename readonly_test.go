@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnlyVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor := vendorFolder
+	defer func() { vendorFolder = oldVendor }()
+	vendorFolder = filepath.Join(dir, "_vendor")
+
+	repo := filepath.Join(vendorFolder, "src", "github.com", "mattn", "gom")
+	err = os.MkdirAll(repo, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(repo, "gom.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(dir, "local")
+	err = os.Mkdir(local, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink(local, filepath.Join(vendorFolder, "src", "github.com", "mattn", "local"))
+	if err != nil {
+		t.Skip(err)
+	}
+	defer chmodTree(vendorFolder, true)
+
+	err = lockVendor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isReadOnlyVendor(vendorFolder) {
+		t.Fatal("Expected the read-only mode to be recorded")
+	}
+	if info, err := os.Stat(filepath.Join(repo, "gom.go")); err != nil || info.Mode().Perm() != 0444 {
+		t.Fatalf("Expected %v, but %v:", os.FileMode(0444), info.Mode().Perm())
+	}
+	if info, err := os.Stat(local); err != nil || info.Mode().Perm() != 0755 {
+		t.Fatalf("Expected the local package to be left writable, but %v:", info.Mode().Perm())
+	}
+	if paths, err := writablePaths(repo); err != nil || len(paths) != 0 {
+		t.Fatalf("Expected no writable paths, but %v %v:", paths, err)
+	}
+	err = os.Chmod(filepath.Join(repo, "gom.go"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths, err := writablePaths(repo); err != nil || !reflect.DeepEqual(paths, []string{"gom.go"}) {
+		t.Fatalf("Expected %v, but %v %v:", []string{"gom.go"}, paths, err)
+	}
+
+	err = unlockVendor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isReadOnlyVendor(vendorFolder) {
+		t.Fatal("Expected the read-only mode to be cleared")
+	}
+	if info, err := os.Stat(repo); err != nil || info.Mode().Perm()&0200 == 0 {
+		t.Fatalf("Expected %v to be writable again", repo)
+	}
+}
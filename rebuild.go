@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// rebuild runs the build step of install for the goms of the Gomfile,
+// without fetching or checking them out again. gom build is taken by go
+// build of the current project.
+func rebuild(args []string) error {
+	args = goArgs(args)
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	vendorGopath = vendor
+
+	goms := filterGoms(allGoms)
+	if !*dryRun {
+		for _, gom := range goms {
+			if !isDir(gom.dir(vendor)) {
+				return fmt.Errorf("%s isn't installed, run gom install first", gom.name)
+			}
+		}
+	}
+	return buildAll(goms, args)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// releaseMarker is written into the directory of a gom fetched from a
+// release, holding the URL of the artifact it was extracted from.
+const releaseMarker = ".gom-release"
+
+type releaseData struct {
+	Tag  string
+	OS   string
+	Arch string
+}
+
+// releaseURL returns the URL of the release artifact gom is fetched from,
+// its release option with the {{.Tag}}, {{.OS}} and {{.Arch}} placeholders
+// expanded, or else its url option.
+func (gom *Gom) releaseURL() (string, error) {
+	release, _ := gom.options["release"].(string)
+	if release == "" {
+		release, _ = gom.options["url"].(string)
+	}
+	t, err := template.New("release").Parse(release)
+	if err != nil {
+		return "", err
+	}
+	tag, _ := gom.options["tag"].(string)
+	var buf bytes.Buffer
+	err = t.Execute(&buf, releaseData{tag, runtime.GOOS, runtime.GOARCH})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// isRelease returns true if gom is fetched from a release artifact, or an
+// archive at a fixed url, rather than a repository.
+func (gom *Gom) isRelease() bool {
+	release, _ := gom.options["release"].(string)
+	u, _ := gom.options["url"].(string)
+	return release != "" || u != ""
+}
+
+// verifyDigest checks sum, the sha256 of what was downloaded from u,
+// against the sha256 option of gom, if it has one.
+func (gom *Gom) verifyDigest(u string, sum []byte) error {
+	want, _ := gom.options["sha256"].(string)
+	if want == "" {
+		return nil
+	}
+	got := hex.EncodeToString(sum)
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("sha256 mismatch for %s: %s expected, but %s", redact(u), want, got)
+	}
+	return nil
+}
+
+// fetchRelease downloads the release artifact of gom and extracts it into
+// its directory, unless it already holds that artifact. Archives other
+// than .tar.gz, .tgz and .zip are saved as they are. The download is
+// extracted as it arrives, next to the directory, which is only replaced
+// once the digest of the download is verified.
+func (gom *Gom) fetchRelease(vendor string) error {
+	u, err := gom.releaseURL()
+	if err != nil {
+		return fmt.Errorf("%s: %v", gom.name, err)
+	}
+	dir := gom.dir(vendor)
+	if b, err := ioutil.ReadFile(filepath.Join(dir, releaseMarker)); err == nil && string(b) == u {
+		progressf("%s already holds %s\n", gom.name, redact(u))
+		return nil
+	}
+	if *dryRun {
+		fmt.Fprintf(stdout, "would download %s to %s\n", redact(u), dir)
+		return nil
+	}
+
+	progressf("downloading %s\n", redact(u))
+	resp, err := httpDo("GET", u, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = os.MkdirAll(filepath.Dir(dir), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	err = os.Chmod(tmp, 0755)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	body := io.TeeReader(resp.Body, h)
+	name := path.Base(strings.SplitN(u, "?", 2)[0])
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		err = extractTarGz(tmp, body)
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(tmp, body)
+	default:
+		err = writeArchiveFile(filepath.Join(tmp, name), body, 0755)
+	}
+	if err == nil {
+		// Whatever follows the end of the archive is part of the digest.
+		_, err = io.Copy(ioutil.Discard, body)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", gom.name, err)
+	}
+	err = gom.verifyDigest(u, h.Sum(nil))
+	if err != nil {
+		return fmt.Errorf("%s: %v", gom.name, err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, releaseMarker), []byte(u), 0644)
+	if err != nil {
+		return err
+	}
+
+	// Leave nothing of an earlier release behind.
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, dir)
+}
+
+// archivePath returns where the archive entry name is extracted in dir,
+// refusing names that would end up outside of it.
+func archivePath(dir, name string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if !inDir(dir, p) {
+		return "", fmt.Errorf("archive entry %s is outside of the archive", name)
+	}
+	return p, nil
+}
+
+// inDir returns true if the clean path p is dir or in it.
+func inDir(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+func writeArchiveFile(p string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// extractLink creates the symlink p of the archive entry h, extracted into
+// dir. Its target must be relative and, as only its leading elements may be
+// .., it can't lead outside of dir through another symlink either.
+func extractLink(dir, p string, h *tar.Header) error {
+	target := h.Linkname
+	if path.IsAbs(target) || filepath.IsAbs(target) {
+		return fmt.Errorf("archive link %s -> %s is absolute", h.Name, target)
+	}
+	elems := strings.Split(target, "/")
+	for len(elems) > 0 && elems[0] == ".." {
+		elems = elems[1:]
+	}
+	for _, e := range elems {
+		if e == ".." {
+			return fmt.Errorf("archive link %s -> %s goes up after going down", h.Name, target)
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	if !inDir(realDir, filepath.Join(parent, filepath.FromSlash(target))) {
+		return fmt.Errorf("archive link %s -> %s is outside of the archive", h.Name, target)
+	}
+	if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, p)
+}
+
+func extractTarGz(dir string, r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := archivePath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(p, 0755)
+		case tar.TypeReg:
+			// Replace a symlink of the same name rather than write through it.
+			if err = os.Remove(p); err == nil || os.IsNotExist(err) {
+				err = writeArchiveFile(p, tr, os.FileMode(h.Mode).Perm())
+			}
+		case tar.TypeSymlink:
+			err = extractLink(dir, p, h)
+		case tar.TypeLink:
+			var target string
+			target, err = archivePath(dir, h.Linkname)
+			if err == nil {
+				if err = os.Remove(p); err == nil || os.IsNotExist(err) {
+					err = os.Link(target, p)
+				}
+			}
+		case tar.TypeXGlobalHeader:
+			// Only holds defaults of the headers, which tar.Reader applied.
+		default:
+			err = fmt.Errorf("archive entry %s is of type %q, which can't be extracted", h.Name, h.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip extracts the zip read from r into dir. As a zip is read from
+// its end, it is saved into a temporary file first.
+func extractZip(dir string, r io.Reader) error {
+	tmp, err := ioutil.TempFile("", "gom-release")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		p, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			err = os.MkdirAll(p, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		mode := f.Mode().Perm()
+		if mode == 0 {
+			// Zip files made on Windows have no permissions.
+			mode = 0644
+		}
+		err = writeArchiveFile(p, r, mode)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasGoFiles returns true if dir holds a Go package to build.
+func hasGoFiles(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(matches) > 0
+}
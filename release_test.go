@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReleaseURL(t *testing.T) {
+	gom := &Gom{name: "github.com/username/protoc-gen-foo", options: map[string]interface{}{
+		"release": "https://github.com/username/protoc-gen-foo/releases/download/{{.Tag}}/protoc-gen-foo_{{.OS}}_{{.Arch}}.tar.gz",
+		"tag":     "v1.2.0",
+	}}
+	expected := "https://github.com/username/protoc-gen-foo/releases/download/v1.2.0/protoc-gen-foo_" + runtime.GOOS + "_" + runtime.GOARCH + ".tar.gz"
+	if u, err := gom.releaseURL(); err != nil || u != expected {
+		t.Fatalf("Expected %v, but %v:", expected, u)
+	}
+}
+
+func TestFetchRelease(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range []struct {
+		name string
+		mode int64
+		body string
+	}{
+		{"bin/protoc-gen-foo", 0755, "#!/bin/sh\n"},
+		{"README", 0644, "foo\n"},
+	} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	zw.Close()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gom := &Gom{name: "example.com/protoc-gen-foo", options: map[string]interface{}{
+		"release": server.URL + "/{{.Tag}}/protoc-gen-foo.tar.gz",
+		"tag":     "v1",
+	}}
+	for i := 0; i < 2; i++ {
+		err = gom.fetchRelease(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected %v, but %v:", 1, requests)
+	}
+	bin := filepath.Join(dir, "src", "example.com", "protoc-gen-foo", "bin", "protoc-gen-foo")
+	fi, err := os.Stat(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0755 {
+		t.Fatalf("Expected %v, but %v:", os.FileMode(0755), fi.Mode().Perm())
+	}
+
+	gom.options["tag"] = "v2"
+	if err = gom.fetchRelease(dir); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("Expected %v, but %v:", 2, requests)
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	body := []byte("package foo\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gom := &Gom{name: "example.com/foo", options: map[string]interface{}{
+		"url":    server.URL + "/v1.2.3/foo.go",
+		"sha256": strings.Repeat("0", 64),
+	}}
+	if !gom.isRelease() {
+		t.Fatal("Expected a gom with a url to be fetched as a release")
+	}
+	err = gom.fetchRelease(dir)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("Expected a sha256 mismatch, but %v:", err)
+	}
+	if isDir(gom.dir(dir)) {
+		t.Fatalf("Expected %v not to be extracted", gom.dir(dir))
+	}
+
+	sum := sha256.Sum256(body)
+	gom.options["sha256"] = hex.EncodeToString(sum[:])
+	err = gom.fetchRelease(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(gom.dir(dir), "foo.go")) {
+		t.Fatalf("Expected %v to be downloaded", filepath.Join(gom.dir(dir), "foo.go"))
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	if _, err := archivePath("/vendor/src/pkg", "../../etc/passwd"); err == nil {
+		t.Fatal("Expected an entry outside of the directory to be refused")
+	}
+	expected := filepath.Join("/vendor/src/pkg", "bin", "tool")
+	if p, err := archivePath("/vendor/src/pkg", "bin/tool"); err != nil || p != expected {
+		t.Fatalf("Expected %v, but %v:", expected, p)
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	for _, c := range []struct {
+		headers []tar.Header
+		err     string
+	}{
+		{[]tar.Header{
+			{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0755, Size: 4},
+			{Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "bin/tool"},
+			{Name: "bin/up", Typeflag: tar.TypeSymlink, Linkname: "../tool"},
+			{Name: "tool2", Typeflag: tar.TypeLink, Linkname: "bin/tool"},
+		}, ""},
+		{[]tar.Header{{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}}, "is absolute"},
+		{[]tar.Header{{Name: "bin/passwd", Typeflag: tar.TypeSymlink, Linkname: "../../etc/passwd"}}, "outside of the archive"},
+		{[]tar.Header{
+			{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "sub/out", Typeflag: tar.TypeSymlink, Linkname: "up/../x"},
+		}, "goes up after going down"},
+		{[]tar.Header{{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../passwd"}}, "outside of the archive"},
+		{[]tar.Header{{Name: "fifo", Typeflag: tar.TypeFifo}}, "can't be extracted"},
+	} {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		for _, h := range c.headers {
+			h := h
+			tw.WriteHeader(&h)
+			if h.Size > 0 {
+				tw.Write([]byte("tool"))
+			}
+		}
+		tw.Close()
+		zw.Close()
+
+		dir, err := ioutil.TempDir("", "gom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		err = extractTarGz(dir, &buf)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("Expected %v, but %v:", c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"tool", "bin/up", "tool2"} {
+			b, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(b) != "tool" {
+				t.Fatalf("Expected %v, but %v:", "tool", []interface{}{string(b), err})
+			}
+		}
+		if fi, err := os.Lstat(filepath.Join(dir, "tool")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("Expected %v to be a symlink", filepath.Join(dir, "tool"))
+		}
+	}
+}
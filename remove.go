@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gomEntry is where a gom is declared in a Gomfile: the lines from start to
+// end, and the groups of the entry, from its group block or option.
+type gomEntry struct {
+	start, end int
+	groups     []string
+}
+
+func groupOption(v interface{}) []string {
+	switch v := v.(type) {
+	case string, []string:
+		return optionValues(v)
+	case []interface{}:
+		groups := make([]string, 0)
+		for _, g := range v {
+			groups = append(groups, fmt.Sprint(g))
+		}
+		return groups
+	}
+	return nil
+}
+
+// gomfileEntries returns the entries of a Gomfile declaring name.
+func gomfileEntries(lines []string, name string) []gomEntry {
+	found := gomLines(lines, name)
+	entries := make([]gomEntry, 0)
+	var block []string
+	for i, line := range lines {
+		if m := re_group.FindStringSubmatch(line); m != nil {
+			block = splitGroups(m[1])
+		} else if re_end.MatchString(line) {
+			block = nil
+		} else if len(found) > 0 && found[0] == i {
+			found = found[1:]
+			groups := append([]string{}, block...)
+			for _, o := range lineOptions(line) {
+				if o.key == "group" {
+					groups = append(groups, groupOption(o.value)...)
+				}
+			}
+			entries = append(entries, gomEntry{i, i, groups})
+		}
+	}
+	return entries
+}
+
+// tomlEntries returns the entries of a Gomfile.toml declaring name. The
+// comments ending a table are left to the next one.
+func tomlEntries(lines []string, name string) []gomEntry {
+	entries := make([]gomEntry, 0)
+	for _, table := range tomlTables(lines, name) {
+		start, end := table[0], table[1]
+		for end > start && strings.HasPrefix(strings.TrimSpace(lines[end]), "#") {
+			end--
+		}
+		var t map[string]interface{}
+		toml.Decode(strings.Join(lines[start+1:end+1], "\n"), &t)
+		entries = append(entries, gomEntry{start, end, groupOption(t["group"])})
+	}
+	return entries
+}
+
+func remove(args []string) error {
+	fs := flag.NewFlagSet("remove", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "also remove the package from the vendor directory")
+	group := fs.String("group", "", "only remove the entry of this group")
+	name := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+	}
+	if name == "" {
+		return errors.New("usage: gom remove <import path> [-group G] [-prune]")
+	}
+
+	filename := gomfilePath()
+	if filename == stdinGomfile {
+		return errors.New("can't edit a Gomfile read from stdin")
+	}
+	lines, mode, err := readLines(filename)
+	if err != nil {
+		return err
+	}
+	var entries []gomEntry
+	if strings.HasSuffix(filename, ".toml") {
+		entries = tomlEntries(lines, name)
+	} else {
+		entries = gomfileEntries(lines, name)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("%s isn't in %s", name, filename)
+	}
+	matched := entries
+	if *group != "" {
+		matched = make([]gomEntry, 0)
+		for _, entry := range entries {
+			if has(entry.groups, *group) {
+				matched = append(matched, entry)
+			}
+		}
+		if len(matched) == 0 {
+			return fmt.Errorf("%s isn't in group %s of %s", name, *group, filename)
+		}
+	}
+	if len(matched) > 1 {
+		fmt.Printf("%s is declared %d times in %s:\n", name, len(matched), filename)
+		for _, entry := range matched {
+			if len(entry.groups) > 0 {
+				fmt.Printf("  line %d (group %s)\n", entry.start+1, strings.Join(entry.groups, ", "))
+			} else {
+				fmt.Printf("  line %d\n", entry.start+1)
+			}
+		}
+		return errors.New("choose the entry to remove with -group")
+	}
+
+	entry := matched[0]
+	lines = append(lines[:entry.start], lines[entry.end+1:]...)
+	err = writeLines(filename, lines, mode)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("removed %s from %s\n", name, filename)
+
+	if *prune && len(entries) == 1 {
+		vendor, err := filepath.Abs(vendorFolder)
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(vendor, "src", filepath.FromSlash(name))
+		if *dryRun {
+			fmt.Printf("would remove %s\n", p)
+			return nil
+		}
+		return os.RemoveAll(p)
+	}
+	return nil
+}
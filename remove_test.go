@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGomfileEntries(t *testing.T) {
+	lines := strings.Split(`gom 'github.com/mattn/go-sqlite3', :tag => 'v1'
+gom 'github.com/mattn/go-runewidth'
+group :test, :ci do
+	gom 'github.com/mattn/go-sqlite3', :branch => 'master'
+end
+gom 'github.com/mattn/go-sqlite3', :group => [:production]
+`, "\n")
+	entries := gomfileEntries(lines, "github.com/mattn/go-sqlite3")
+	expected := []gomEntry{
+		{0, 0, []string{}},
+		{3, 3, []string{"test", "ci"}},
+		{5, 5, []string{"production"}},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, entries)
+	}
+}
+
+func TestTomlEntries(t *testing.T) {
+	lines := strings.Split(`[[gom]]
+name = "github.com/mattn/go-sqlite3"
+group = ["test"]
+
+# tools
+[[gom]]
+name = "github.com/mattn/go-runewidth"
+`, "\n")
+	entries := tomlEntries(lines, "github.com/mattn/go-sqlite3")
+	expected := []gomEntry{{0, 3, []string{"test"}}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, entries)
+	}
+}
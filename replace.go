@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vcsByName are the vcsCmds by the names guessVCS returns.
+var vcsByName = map[string]*vcsCmd{
+	"git": git, "hg": hg, "bzr": bzr, "svn": svn, "fossil": fossil,
+}
+
+// replaceSource returns the URL of the repository given by the replace
+// option of gom, an import path or a URL, and the VCS to clone it with, git
+// unless the path tells otherwise.
+func (gom *Gom) replaceSource() (string, *vcsCmd) {
+	replace, _ := gom.options["replace"].(string)
+	u, path := "https://"+replace, replace
+	if i := strings.Index(replace, "://"); i >= 0 {
+		u, path = replace, replace[i+len("://"):]
+	}
+	if vcs, ok := vcsByName[guessVCS(path)]; ok {
+		return u, vcs
+	}
+	return u, git
+}
+
+// replaceInstalled returns true if the directory of gom holds a clone of
+// the repository at u.
+func (gom *Gom) replaceInstalled(vendor, u string) bool {
+	dir := gom.dir(vendor)
+	vcs := detectVCS(dir)
+	if vcs == nil || vcs.remote == nil {
+		return false
+	}
+	remote, err := vcs.Remote(dir)
+	return err == nil && strings.TrimSuffix(remote, ".git") == strings.TrimSuffix(u, ".git")
+}
+
+// cloneReplace clones the repository given by the replace option of gom
+// into the directory of gom, in place of the one of its import path, unless
+// it is already there.
+func (gom *Gom) cloneReplace(vendor string) error {
+	u, vcs := gom.replaceSource()
+	if gom.replaceInstalled(vendor, u) {
+		progressf("%s already holds %s\n", getTarget(gom), u)
+		return nil
+	}
+	if vcs.create == nil {
+		return fmt.Errorf("gom can't clone %s repositories, for %s", vcs.name, gom.name)
+	}
+	err := gom.requireTool(vcs.name)
+	if err != nil {
+		return err
+	}
+	dir := gom.dir(vendor)
+	if !*dryRun {
+		// Whatever was there before, such as the original repository.
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(dir), 0755)
+		if err != nil {
+			return err
+		}
+	}
+	progressf("cloning %s into %s\n", u, getTarget(gom))
+	return runRetry("", append(withGitJobs(append([]string{}, vcs.create...)), u, dir), Blue)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplaceSource(t *testing.T) {
+	for _, c := range []struct {
+		replace string
+		url     string
+		vcs     *vcsCmd
+	}{
+		{"github.com/patched/go-sqlite3", "https://github.com/patched/go-sqlite3", git},
+		{"example.com/mirror/repo.hg", "https://example.com/mirror/repo.hg", hg},
+		{"ssh://git@example.com/mirror/repo", "ssh://git@example.com/mirror/repo", git},
+		{"https://launchpad.net/goyaml", "https://launchpad.net/goyaml", bzr},
+	} {
+		gom := &Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"replace": c.replace}}
+		if u, vcs := gom.replaceSource(); u != c.url || vcs != c.vcs {
+			t.Fatalf("Expected %v %v, but %v %v:", c.url, c.vcs.name, u, vcs.name)
+		}
+	}
+}
+
+func TestCloneReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mirror := filepath.Join(dir, "mirror")
+	_, second := initGitRepo(t, mirror, "https://example.com/mirror.git")
+	vendor := filepath.Join(dir, "vendor")
+	// The original repository, installed before.
+	original := filepath.Join(vendor, "src", "github.com", "mattn", "go-sqlite3")
+	initGitRepo(t, original, "https://github.com/mattn/go-sqlite3.git")
+
+	gom := &Gom{name: "github.com/mattn/go-sqlite3", options: map[string]interface{}{"replace": "file://" + filepath.ToSlash(mirror)}}
+	for i := 0; i < 2; i++ {
+		err = gom.cloneReplace(vendor)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if revision, _ := git.Revision(original); revision != second {
+		t.Fatalf("Expected %v, but %v:", second, revision)
+	}
+	if u, _ := gom.replaceSource(); !gom.replaceInstalled(vendor, u) {
+		t.Fatalf("Expected %v to be installed", u)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reporter is told of each step, clone, checkout or build, taken for a gom,
+// and of the summary of an install once it's done.
+type reporter interface {
+	step(phase, name string, d time.Duration, err error)
+	summary(s installSummary)
+}
+
+// phaseTime is how long a phase of an install, e.g. fetch, took.
+type phaseTime struct {
+	phase string
+	d     time.Duration
+}
+
+// installSummary is what an install amounted to: how many goms the Gomfile
+// named and how many more recursive ones pulled in, the disk space the
+// vendor directory takes, and the time spent in each phase.
+type installSummary struct {
+	direct      int
+	transitive  int
+	vendorBytes int64
+	phases      []phaseTime
+}
+
+// timePhase records the phase started at start as done.
+func (s *installSummary) timePhase(phase string, start time.Time) {
+	s.phases = append(s.phases, phaseTime{phase, time.Since(start)})
+}
+
+// formatBytes returns n in the largest unit it makes at least one of.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// humanReporter reports nothing more than the progress messages, and the
+// summary unless -q is given.
+type humanReporter struct{}
+
+func (humanReporter) step(phase, name string, d time.Duration, err error) {}
+
+func (humanReporter) summary(s installSummary) {
+	if *quiet {
+		return
+	}
+	fmt.Fprintf(stdout, "installed %d bundles: %d direct, %d transitive\n", s.direct+s.transitive, s.direct, s.transitive)
+	fmt.Fprintf(stdout, "%s takes %s\n", vendorFolder, formatBytes(s.vendorBytes))
+	times := make([]string, 0)
+	for _, p := range s.phases {
+		times = append(times, fmt.Sprintf("%s %s", p.phase, p.d.Round(10*time.Millisecond)))
+	}
+	fmt.Fprintf(stdout, "%s\n", strings.Join(times, ", "))
+}
+
+type event struct {
+	Phase      string `json:"phase"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// jsonReporter writes one JSON object per step, for CI dashboards.
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONReporter(w io.Writer) *jsonReporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) step(phase, name string, d time.Duration, err error) {
+	e := event{Phase: phase, Name: name, Status: "ok", DurationMS: int64(d / time.Millisecond)}
+	if err != nil {
+		e.Status, e.Error = "error", redact(err.Error())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
+
+type summaryEvent struct {
+	Phase       string           `json:"phase"`
+	Direct      int              `json:"direct"`
+	Transitive  int              `json:"transitive"`
+	VendorBytes int64            `json:"vendor_bytes"`
+	DurationMS  map[string]int64 `json:"duration_ms"`
+}
+
+func (r *jsonReporter) summary(s installSummary) {
+	e := summaryEvent{Phase: "summary", Direct: s.direct, Transitive: s.transitive, VendorBytes: s.vendorBytes, DurationMS: map[string]int64{}}
+	for _, p := range s.phases {
+		e.DurationMS[p.phase] = int64(p.d / time.Millisecond)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
+
+// report is selected from -output at startup.
+var report reporter = humanReporter{}
+
+// setOutput selects the reporter for the -output format. The json events
+// are written to w, and the progress and the output of the commands gom
+// runs are sent to stderr so as not to be mixed in with them. What a
+// command such as gom list prints for itself still goes to stdout.
+func setOutput(format string, w io.Writer) error {
+	switch format {
+	case "human":
+	case "json":
+		report = newJSONReporter(w)
+		stdout = os.Stderr
+	default:
+		return fmt.Errorf("unknown output %q, use human or json", format)
+	}
+	return nil
+}
+
+// reportStep reports the step started at start, meant to be deferred with
+// the address of the named error result of the step.
+func reportStep(phase, name string, start time.Time, err *error) {
+	report.step(phase, name, time.Since(start), *err)
+}
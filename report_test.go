@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := newJSONReporter(&buf)
+	r.step("clone", "github.com/mattn/go-runewidth", 1500*time.Millisecond, nil)
+	r.step("build", "github.com/mattn/go-sqlite3", 20*time.Millisecond, errors.New("exit status 2"))
+	expected := `{"phase":"clone","name":"github.com/mattn/go-runewidth","status":"ok","duration_ms":1500}
+{"phase":"build","name":"github.com/mattn/go-sqlite3","status":"error","duration_ms":20,"error":"exit status 2"}
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+}
+
+func TestReporterSummary(t *testing.T) {
+	s := installSummary{
+		direct:      2,
+		transitive:  1,
+		vendorBytes: 3 << 20,
+		phases:      []phaseTime{{"fetch", 1200 * time.Millisecond}, {"build", 40 * time.Millisecond}},
+	}
+
+	var buf bytes.Buffer
+	newJSONReporter(&buf).summary(s)
+	expected := `{"phase":"summary","direct":2,"transitive":1,"vendor_bytes":3145728,"duration_ms":{"build":40,"fetch":1200}}
+`
+	if buf.String() != expected {
+		t.Fatalf("Expected %v, but %v:", expected, buf.String())
+	}
+
+	f, err := ioutil.TempFile("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	oldstdout := stdout
+	defer func() { stdout = oldstdout }()
+	stdout = f
+	humanReporter{}.summary(s)
+	f.Close()
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "installed 3 bundles: 2 direct, 1 transitive\n" + vendorFolder + " takes 3.0 MiB\nfetch 1.2s, build 40ms\n"
+	if string(b) != expected {
+		t.Fatalf("Expected %v, but %v:", expected, string(b))
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	oldreport, oldstdout, oldStdout, oldquiet := report, stdout, os.Stdout, *quiet
+	defer func() {
+		report, stdout, os.Stdout, *quiet = oldreport, oldstdout, oldStdout, oldquiet
+	}()
+	var buf bytes.Buffer
+	err := setOutput("json", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.step("clone", "github.com/mattn/go-runewidth", 0, nil)
+	if buf.Len() == 0 {
+		t.Fatalf("Expected the event to be written to the writer given, but nothing:")
+	}
+	if stdout != os.Stderr {
+		t.Fatalf("Expected the progress to go to stderr, but %v:", stdout)
+	}
+	if os.Stdout != oldStdout || *quiet != oldquiet {
+		t.Fatalf("Expected os.Stdout and -q to be left alone, but %v and %v:", os.Stdout, *quiet)
+	}
+	err = setOutput("xml", &buf)
+	if err == nil {
+		t.Fatalf("Expected an unknown output to be an error, but nil:")
+	}
+}
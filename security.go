@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// osvURL is where the vulnerabilities of a module version are looked up, in
+// the format of the OSV API, which serves the Go vulnerability database.
+var osvURL = "https://api.osv.dev/v1/query"
+
+type osvEvent struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string     `json:"type"`
+			Events []osvEvent `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+}
+
+// fixedIn returns the lowest version of module above current fixing the
+// vulnerability, or "" if none does yet.
+func (v *osvVuln) fixedIn(module string, current version) string {
+	fixed := ""
+	var fixedVersion version
+	for _, a := range v.Affected {
+		if a.Package.Name != module {
+			continue
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			for _, e := range r.Events {
+				f, ok := parseVersion(e.Fixed)
+				if !ok || f.compare(current) <= 0 {
+					continue
+				}
+				if fixed == "" || f.compare(fixedVersion) < 0 {
+					fixed, fixedVersion = "v"+strings.TrimPrefix(e.Fixed, "v"), f
+				}
+			}
+		}
+	}
+	return fixed
+}
+
+// queryOSV returns the known vulnerabilities of module at the version v.
+func queryOSV(module string, v version) ([]osvVuln, error) {
+	var query struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Version string `json:"version"`
+	}
+	query.Package.Name = module
+	query.Package.Ecosystem = "Go"
+	// The Go ecosystem of OSV has its versions in full, without the v.
+	query.Version = fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+	if v.pre != "" {
+		query.Version += "-" + v.pre
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpDo("POST", osvURL, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &FetchError{[]string{"POST", osvURL}, err}
+	}
+	var result struct {
+		Vulns []osvVuln `json:"vulns"`
+	}
+	err = json.Unmarshal(b, &result)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the vulnerabilities of %s from %s: %v", module, osvURL, err)
+	}
+	return result.Vulns, nil
+}
+
+// vulnModule returns the module the repository root of the package name
+// holds, as the vulnerability database knows it: the one its go.mod
+// declares, or else the root of its import path.
+func vulnModule(root, name string) string {
+	if root != "" {
+		if module := goModModule(filepath.Join(root, gomod)); module != "" {
+			return module
+		}
+	}
+	if m := majorVersion.FindString(name); m != "" {
+		return repoRoot(strings.TrimSuffix(name, m)) + m
+	}
+	return repoRoot(name)
+}
+
+// checkoutVersion returns the highest version tag of the checkout p at its
+// revision, and true. Without one, a git checkout descending from a version
+// tag gets the highest of those, and false, as it may have fixes since. It
+// returns "" if there is no such tag.
+func checkoutVersion(p string, vcs *vcsCmd) (string, bool, error) {
+	head, err := vcs.Revision(p)
+	if err != nil {
+		return "", false, err
+	}
+	tags, err := vcs.Tags(p)
+	if err != nil {
+		return "", false, err
+	}
+	at := make([]string, 0)
+	for _, tag := range tags {
+		if _, ok := parseVersion(tag); !ok {
+			continue
+		}
+		if rev, err := vcs.Resolve(p, tag); err == nil && rev == head {
+			at = append(at, tag)
+		}
+	}
+	if tag, err := highestTag(at, ">=0.0.0"); err == nil {
+		return tag, true, nil
+	}
+	if vcs != git {
+		return "", false, nil
+	}
+	out, err := vcsOutput(p, "git", "tag", "--merged", "HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	if tag, err := highestTag(strings.Fields(out), ">=0.0.0"); err == nil {
+		return tag, false, nil
+	}
+	return "", false, nil
+}
+
+// securityReport prints the goms installed at a version with known
+// vulnerabilities, their IDs and the lowest version fixing them all, and
+// returns how many there are. A gom pinned to a commit past its last version
+// tag is only guessed to be at that version, so what is known of it is a
+// warning, which doesn't count.
+func securityReport(goms []Gom, vendor string) (int, error) {
+	vulnerable := 0
+	for _, gom := range goms {
+		if _, ok := gom.localPath(); ok {
+			continue
+		}
+		var v, module string
+		exact := true
+		if gom.isRelease() {
+			v, _ = gom.options["tag"].(string)
+			module = vulnModule("", gom.name)
+		} else {
+			root, vcs := findRepo(filepath.Join(vendor, "src"), getTarget(&gom))
+			if vcs == nil {
+				warnf("%s is not installed\n", gom.name)
+				continue
+			}
+			if vcs.resolve == nil {
+				warnf("gom can't tell the version of %s repositories, skipping %s\n", vcs.name, gom.name)
+				continue
+			}
+			var err error
+			v, exact, err = checkoutVersion(root, vcs)
+			if err != nil {
+				return vulnerable, err
+			}
+			module = vulnModule(root, gom.name)
+		}
+		current, ok := parseVersion(v)
+		if !ok {
+			warnf("%s has no version tag to look up vulnerabilities for\n", gom.name)
+			continue
+		}
+		vulns, err := queryOSV(module, current)
+		if err != nil {
+			return vulnerable, err
+		}
+		if len(vulns) == 0 {
+			continue
+		}
+		w := io.Writer(os.Stdout)
+		if exact {
+			vulnerable++
+			fmt.Fprintf(w, "%s %s\n", gom.name, v)
+		} else {
+			w = os.Stderr
+			warnf("%s is past %s, which has known vulnerabilities it may have fixes for since\n", gom.name, v)
+		}
+		safe := ""
+		var safeVersion version
+		unfixed := false
+		for _, vuln := range vulns {
+			id := vuln.ID
+			if len(vuln.Aliases) > 0 {
+				id += " (" + strings.Join(vuln.Aliases, ", ") + ")"
+			}
+			fixed := vuln.fixedIn(module, current)
+			if fixed == "" {
+				unfixed = true
+				fmt.Fprintf(w, "  %s: %s, not fixed yet\n", id, vuln.Summary)
+				continue
+			}
+			fmt.Fprintf(w, "  %s: %s, fixed in %s\n", id, vuln.Summary, fixed)
+			if f, _ := parseVersion(fixed); safe == "" || f.compare(safeVersion) > 0 {
+				safe, safeVersion = fixed, f
+			}
+		}
+		if safe != "" && !unfixed {
+			fmt.Fprintf(w, "  upgrade to %s or later\n", safe)
+		}
+	}
+	return vulnerable, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixedIn(t *testing.T) {
+	var vuln osvVuln
+	err := json.Unmarshal([]byte(`{"id": "GO-2022-0001", "affected": [
+		{"package": {"name": "github.com/mattn/go-sqlite3", "ecosystem": "Go"}, "ranges": [
+			{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.4"}, {"introduced": "1.3.0"}, {"fixed": "1.3.2"}]}
+		]},
+		{"package": {"name": "github.com/mattn/go-gtk", "ecosystem": "Go"}, "ranges": [
+			{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.1.0"}]}
+		]}
+	]}`), &vuln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		current  string
+		expected string
+	}{
+		{"v1.0.0", "v1.2.4"},
+		{"v1.3.1", "v1.3.2"},
+		{"v1.4.0", ""},
+	} {
+		current, _ := parseVersion(c.current)
+		if fixed := vuln.fixedIn("github.com/mattn/go-sqlite3", current); fixed != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, fixed)
+		}
+	}
+}
+
+func TestVulnModule(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/go-sqlite3", "github.com/mattn/go-sqlite3"},
+		{"github.com/mattn/go-sqlite3/sqlite3", "github.com/mattn/go-sqlite3"},
+		{"github.com/mattn/go-sqlite3/v2", "github.com/mattn/go-sqlite3/v2"},
+		{"example.com/repo/pkg", "example.com/repo/pkg"},
+	} {
+		if module := vulnModule("", c.name); module != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, module)
+		}
+	}
+}
+
+func TestSecurityReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	repo := filepath.Join(dir, "src", "github.com", "mattn", "gom")
+	first, second := initGitRepo(t, repo, "https://github.com/mattn/gom.git")
+
+	queried := make([]string, 0)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			Package struct {
+				Name string `json:"name"`
+			} `json:"package"`
+			Version string `json:"version"`
+		}
+		json.NewDecoder(r.Body).Decode(&query)
+		queried = append(queried, query.Package.Name+"@"+query.Version)
+		w.Write([]byte(`{"vulns": [{"id": "GO-2022-0001", "aliases": ["CVE-2022-1234"], "summary": "crash on bad input", "affected": [
+			{"package": {"name": "github.com/mattn/gom", "ecosystem": "Go"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.0.1"}]}]}
+		]}]}`))
+	}))
+	defer ts.Close()
+	oldURL := osvURL
+	defer func() { osvURL = oldURL }()
+	osvURL = ts.URL
+
+	goms := []Gom{{name: "github.com/mattn/gom", options: map[string]interface{}{"commit": "v1"}}}
+	// The second commit only descends from v1, the first is at it.
+	if v, exact, err := checkoutVersion(repo, git); err != nil || v != "v1" || exact {
+		t.Fatalf("Expected %v, but %v %v %v:", "v1", v, exact, err)
+	}
+	cmd := exec.Command("git", "checkout", "-q", first)
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if v, exact, err := checkoutVersion(repo, git); err != nil || v != "v1" || !exact {
+		t.Fatalf("Expected %v, but %v %v %v:", "v1", v, exact, err)
+	}
+
+	n, err := securityReport(goms, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Expected %v, but %v:", 1, n)
+	}
+	if len(queried) != 1 || queried[0] != "github.com/mattn/gom@1.0.0" {
+		t.Fatalf("Expected %v, but %v:", []string{"github.com/mattn/gom@1.0.0"}, queried)
+	}
+
+	// Past v1, it may have the fixes already: a warning, not a failure.
+	cmd = exec.Command("git", "checkout", "-q", second)
+	cmd.Dir = repo
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	n, err = securityReport(goms, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("Expected %v, but %v:", 0, n)
+	}
+	if len(queried) != 2 {
+		t.Fatalf("Expected %v, but %v:", 2, len(queried))
+	}
+}
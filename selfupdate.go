@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// releasesURL is where the latest release of gom is looked up, in the
+// format of the GitHub API.
+var releasesURL = "https://api.github.com/repos/mattn/gom/releases/latest"
+
+// checksumsAsset is the asset of a release listing the SHA-256 of the
+// others, as sha256sum prints them.
+const checksumsAsset = "checksums.txt"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the URL of the asset name of r, or "".
+func (r *githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// binaryAsset is the name of the asset holding gom for this platform.
+func binaryAsset() string {
+	name := fmt.Sprintf("gom_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func latestRelease() (*githubRelease, error) {
+	body, err := httpGet(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var r githubRelease
+	err = json.Unmarshal(body, &r)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the release at %s: %v", releasesURL, err)
+	}
+	return &r, nil
+}
+
+// releaseChecksum returns the SHA-256 of name listed in checksums.
+func releaseChecksum(checksums []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], true
+		}
+	}
+	return "", false
+}
+
+// downloadUpdate downloads the gom binary of r for this platform, and
+// refuses it unless it matches the checksum r lists for it.
+func downloadUpdate(r *githubRelease) ([]byte, error) {
+	name := binaryAsset()
+	u := r.assetURL(name)
+	if u == "" {
+		return nil, fmt.Errorf("gom %s has no binary for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	cu := r.assetURL(checksumsAsset)
+	if cu == "" {
+		return nil, fmt.Errorf("gom %s has no %s to verify %s with", r.TagName, checksumsAsset, name)
+	}
+	checksums, err := httpGet(cu)
+	if err != nil {
+		return nil, err
+	}
+	want, ok := releaseChecksum(checksums, name)
+	if !ok {
+		return nil, fmt.Errorf("%s of gom %s has no checksum for %s", checksumsAsset, r.TagName, name)
+	}
+	progressf("downloading gom %s\n", r.TagName)
+	body, err := httpGet(u)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, want) {
+		return nil, fmt.Errorf("checksum mismatch for %s: %s recorded, but %s", name, want, got)
+	}
+	return body, nil
+}
+
+// replaceExecutable replaces the file exe with body. The new binary is
+// written next to it and renamed over it, so exe is never half written.
+func replaceExecutable(exe string, body []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), "."+filepath.Base(exe)+".new")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0755)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		// A running executable can't be replaced, only renamed.
+		old := exe + ".old"
+		os.Remove(old)
+		err = os.Rename(exe, old)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// selfUpdate replaces the running gom with the latest release, if it is
+// newer, or with -check only tells whether there is one.
+func selfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	onlyCheck := fs.Bool("check", false, "only report whether a newer gom is released")
+	fs.Parse(args)
+
+	r, err := latestRelease()
+	if err != nil {
+		return err
+	}
+	latest, ok := parseVersion(r.TagName)
+	if !ok {
+		return fmt.Errorf("the latest release of gom, %s, isn't a version", r.TagName)
+	}
+	current, isRelease := parseVersion(gomVersion)
+	if isRelease && latest.compare(current) <= 0 {
+		fmt.Printf("gom %s is up to date\n", gomVersion)
+		return nil
+	}
+	if *onlyCheck {
+		fmt.Printf("gom %s is released, this is %s\n", r.TagName, gomVersion)
+		return nil
+	}
+	if !isRelease && !*force {
+		return fmt.Errorf("gom %s isn't a release, use -force to replace it with %s", gomVersion, r.TagName)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("would replace %s with gom %s\n", exe, r.TagName)
+		return nil
+	}
+	body, err := downloadUpdate(r)
+	if err != nil {
+		return err
+	}
+	err = replaceExecutable(exe, body)
+	if err != nil {
+		return err
+	}
+	progressf("updated gom from %s to %s\n", gomVersion, r.TagName)
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadUpdate(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho gom v0.5.0\n")
+	sum := sha256.Sum256(binary)
+	checksums := hex.EncodeToString(sum[:]) + "  " + binaryAsset() + "\n"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			w.Write([]byte(`{"tag_name": "v0.5.0", "assets": [
+				{"name": "` + binaryAsset() + `", "browser_download_url": "` + server.URL + `/gom"},
+				{"name": "checksums.txt", "browser_download_url": "` + server.URL + `/checksums.txt"}
+			]}`))
+		case "/gom":
+			w.Write(binary)
+		case "/checksums.txt":
+			w.Write([]byte(checksums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	oldURL := releasesURL
+	defer func() { releasesURL = oldURL }()
+	releasesURL = server.URL + "/latest"
+
+	r, err := latestRelease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TagName != "v0.5.0" {
+		t.Fatalf("Expected %v, but %v:", "v0.5.0", r.TagName)
+	}
+	body, err := downloadUpdate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "gom")
+	err = ioutil.WriteFile(exe, []byte("old"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = replaceExecutable(exe, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(binary) {
+		t.Fatalf("Expected %v, but %v:", string(binary), string(b))
+	}
+
+	// A binary that doesn't match its checksum is refused.
+	checksums = strings.Repeat("0", 64) + "  " + binaryAsset() + "\n"
+	_, err = downloadUpdate(r)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch, but %v:", err)
+	}
+}
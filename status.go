@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// wantedRevision returns the revision the repository p of gom should be
+// checked out at, and its version option as given, or "" if gom isn't
+// pinned to a revision its VCS can resolve. Tags that are version
+// constraints are resolved against the tags already fetched.
+func (gom *Gom) wantedRevision(p string, vcs *vcsCmd) (string, string, error) {
+	keys := versionOptions(gom)
+	if len(keys) != 1 || keys[0] == "ref" || vcs.resolve == nil {
+		// A ref can't be resolved without fetching it.
+		return "", "", nil
+	}
+	version := gom.version()
+	rev := version
+	if keys[0] == "tag" && isVersionConstraint(version) {
+		tags, err := vcs.Tags(p)
+		if err != nil {
+			return "", "", err
+		}
+		rev, err = highestTag(tags, version)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	wanted, err := vcs.Resolve(p, rev)
+	if err != nil {
+		return "", "", err
+	}
+	return wanted, keys[0] + " " + version, nil
+}
+
+// repoStatus returns what is amiss with the vendored repository p: a line
+// for its revision if gom is given and it isn't checked out where gom is
+// pinned, then a line for each changed file.
+func repoStatus(p string, vcs *vcsCmd, gom *Gom, pinnedIn string) ([]string, error) {
+	problems := make([]string, 0)
+	if gom != nil {
+		wanted, version, err := gom.wantedRevision(p, vcs)
+		if err != nil {
+			return nil, err
+		}
+		if wanted != "" {
+			current, err := vcs.Revision(p)
+			if err != nil {
+				return nil, err
+			}
+			if current != wanted {
+				problems = append(problems, fmt.Sprintf("at %s, but %s pins %s (%s)", current, pinnedIn, version, wanted))
+			}
+		}
+	}
+	changes, err := vcs.Changes(p)
+	if err != nil {
+		return nil, err
+	}
+	return append(problems, changes...), nil
+}
+
+// status lists the vendored repositories with local changes, or checked out
+// at another revision than Gomfile, or Gomfile.lock, pins, or with writable
+// files once -read-only made them read-only. It only reads the
+// repositories, and leaves out the clean ones.
+func status() error {
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	pinnedIn := map[string]string{}
+	for _, gom := range allGoms {
+		pinnedIn[gom.name] = gomfilePath()
+	}
+	if !*noLock && isFile(lockfilePath()) {
+		locks, err := parseLockfile(lockfilePath())
+		if err != nil {
+			return err
+		}
+		applyLocks(allGoms, locks)
+		for _, l := range locks {
+			if _, ok := pinnedIn[l.name]; ok {
+				pinnedIn[l.name] = lockfilePath()
+			}
+		}
+	}
+	goms := filterGoms(allGoms)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(vendor, "src")
+	pinned := map[string]*Gom{}
+	for i := range goms {
+		if _, ok := goms[i].localPath(); ok || goms[i].isRelease() {
+			continue
+		}
+		if root, vcs := findRepo(src, getTarget(&goms[i])); vcs != nil {
+			pinned[root] = &goms[i]
+		}
+	}
+
+	repos, err := vendoredRepos(vendor)
+	if err != nil {
+		return err
+	}
+	readOnly := isReadOnlyVendor(vendor)
+	if readOnly {
+		fmt.Printf("%s is read-only\n", src)
+	}
+	for _, repo := range repos {
+		p := filepath.Join(src, filepath.FromSlash(repo))
+		gom := pinned[p]
+		in := ""
+		if gom != nil {
+			in = pinnedIn[gom.name]
+		}
+		problems, err := repoStatus(p, detectVCS(p), gom, in)
+		if err != nil {
+			warnf("can't tell the status of %s: %v\n", repo, err)
+			continue
+		}
+		if readOnly {
+			writable, err := writablePaths(p)
+			if err != nil {
+				return err
+			}
+			for _, path := range writable {
+				problems = append(problems, "writable "+path)
+			}
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		fmt.Printf("%s\n  %s\n", repo, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepoStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	first, second := initGitRepo(t, dir, "https://github.com/mattn/gom.git")
+
+	gom := &Gom{name: "github.com/mattn/gom", options: map[string]interface{}{"commit": second}}
+	problems, err := repoStatus(dir, git, gom, "Gomfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("Expected %v, but %v:", []string{}, problems)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "patch.go"), []byte("package gom\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gom.options = map[string]interface{}{"tag": "v1"}
+	problems, err = repoStatus(dir, git, gom, "Gomfile.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"at " + second + ", but Gomfile.lock pins tag v1 (" + first + ")",
+		"?? patch.go",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, problems)
+	}
+
+	// Repositories that aren't in Gomfile only have their changes listed.
+	problems, err = repoStatus(dir, git, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(problems, expected[1:]) {
+		t.Fatalf("Expected %v, but %v:", expected[1:], problems)
+	}
+}
+
+func TestChangesLeaveIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initGitRepo(t, dir, "https://github.com/mattn/gom.git")
+	err = ioutil.WriteFile(filepath.Join(dir, "gom.go"), []byte("package gom\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", "gom.go"}, {"commit", "-q", "-m", "third"}} {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=gom", "-c", "user.email=gom@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	// A read-only check mustn't refresh the stat information of the index.
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "gom.go"), later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(dir, ".git", "index")
+	before, err := ioutil.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := git.Changes(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Expected %v, but %v:", []string{}, changes)
+	}
+	after, err := ioutil.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatal("Expected git status to leave the index alone")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// testValueFlags are the flags of go test taking a value as the next
+// argument, which must not be mistaken for a package.
+var testValueFlags = []string{
+	"bench", "benchtime", "blockprofile", "blockprofilerate", "count",
+	"coverpkg", "covermode", "coverprofile", "cpu", "cpuprofile", "exec",
+	"gcflags", "ldflags", "asmflags", "memprofile", "memprofilerate", "mod",
+	"mutexprofile", "o", "outputdir", "p", "parallel", "run", "skip",
+	"tags", "timeout", "trace", "vet",
+}
+
+// hasPackageArg returns true if args of go test name a package.
+func hasPackageArg(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" {
+			return false
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return true
+		}
+		name := strings.TrimLeft(arg, "-")
+		if !strings.Contains(name, "=") && has(testValueFlags, strings.TrimPrefix(name, "test.")) {
+			i++
+		}
+	}
+	return false
+}
+
+// testArgs returns the go test command for args, testing ./... unless a
+// package is given.
+func testArgs(args []string) []string {
+	cmdArgs := []string{goCommand(), "test"}
+	if hasPackageArg(args) {
+		return append(cmdArgs, args...)
+	}
+	for i, arg := range args {
+		if arg == "-args" {
+			cmdArgs = append(cmdArgs, args[:i]...)
+			cmdArgs = append(cmdArgs, "./...")
+			return append(cmdArgs, args[i:]...)
+		}
+	}
+	cmdArgs = append(cmdArgs, args...)
+	return append(cmdArgs, "./...")
+}
+
+// test runs go test with the bundles, after making sure those of the test
+// group are installed.
+func test(args []string) error {
+	*testEnv = true
+	if gomfilePath() != stdinGomfile && !isFile(gomfilePath()) {
+		return run(testArgs(args), None)
+	}
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	for _, gom := range filterGoms(allGoms) {
+		if gom.vcs(vendor) == nil && !isDir(gom.dir(vendor)) {
+			return fmt.Errorf("%s is not installed, run gom -test install first", gom.name)
+		}
+	}
+	return run(testArgs(args), None)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTestArgs(t *testing.T) {
+	for _, c := range []struct {
+		args, expected []string
+	}{
+		{[]string{}, []string{"go", "test", "./..."}},
+		{[]string{"-v", "-run", "TestFoo"}, []string{"go", "test", "-v", "-run", "TestFoo", "./..."}},
+		{[]string{"-run=TestFoo", "./foo"}, []string{"go", "test", "-run=TestFoo", "./foo"}},
+		{[]string{"-v", "github.com/mattn/gom"}, []string{"go", "test", "-v", "github.com/mattn/gom"}},
+		{[]string{"-v", "-args", "foo"}, []string{"go", "test", "-v", "./...", "-args", "foo"}},
+	} {
+		if args := testArgs(c.args); !reflect.DeepEqual(args, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, args)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// lookPath finds the tools gom runs, replaced by the tests.
+var lookPath = exec.LookPath
+
+// hostVCS are the VCSs of the repositories of well known hosts.
+var hostVCS = map[string]string{
+	"github.com":    "git",
+	"gitlab.com":    "git",
+	"bitbucket.org": "git",
+	"launchpad.net": "bzr",
+}
+
+// guessVCS returns the name of the VCS a gom is fetched with, from its host
+// or a .git, .hg, .bzr, .svn or .fossil suffix as go get understands them,
+// or "" when it can't tell before fetching it.
+func guessVCS(name string) string {
+	elems := strings.Split(name, "/")
+	if vcs, ok := hostVCS[elems[0]]; ok {
+		return vcs
+	}
+	for _, elem := range elems {
+		for _, vcs := range []string{"git", "hg", "bzr", "svn", "fossil"} {
+			if strings.HasSuffix(elem, "."+vcs) {
+				return vcs
+			}
+		}
+	}
+	return ""
+}
+
+// tools returns the commands needed to fetch gom into vendor and check it out.
+func (gom *Gom) tools(vendor string) []string {
+	if _, ok := gom.localPath(); ok || gom.isRelease() {
+		return nil
+	}
+	if vcs := gom.vcs(vendor); vcs != nil {
+		if gom.version() == "" {
+			return nil
+		}
+		return []string{vcs.name}
+	}
+	tools := make([]string, 0)
+	if command, ok := gom.options["command"].(string); ok {
+		if fields := strings.Fields(command); len(fields) > 0 {
+			tools = append(tools, fields[0])
+		}
+	} else if has(gom.options, "replace") {
+		_, vcs := gom.replaceSource()
+		tools = append(tools, vcs.name)
+	} else if private, ok := gom.options["private"].(string); ok && boolString[strings.ToLower(private)] {
+		tools = append(tools, "git")
+	} else if vcs := guessVCS(getFork(gom)); vcs != "" {
+		tools = append(tools, vcs)
+	}
+	return append(tools, goCommand())
+}
+
+// requireTools returns a MissingToolError for the tools needed by goms that
+// aren't on PATH, all of them at once.
+func requireTools(goms []Gom, vendor string) error {
+	missing := make(map[string][]string)
+	for i := range goms {
+		for _, tool := range goms[i].tools(vendor) {
+			if _, err := lookPath(tool); err != nil && !has(missing[tool], goms[i].name) {
+				missing[tool] = append(missing[tool], goms[i].name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingToolError{missing}
+	}
+	return nil
+}
+
+// requireTool returns a MissingToolError if tool, needed by gom, isn't on
+// PATH.
+func (gom *Gom) requireTool(tool string) error {
+	if _, err := lookPath(tool); err != nil {
+		return &MissingToolError{map[string][]string{tool: {gom.name}}}
+	}
+	return nil
+}
+
+func sortedTools(missing map[string][]string) []string {
+	tools := make([]string, 0, len(missing))
+	for tool := range missing {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	return tools
+}
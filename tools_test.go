@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGuessVCS(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{"github.com/mattn/gom", "git"},
+		{"launchpad.net/goyaml", "bzr"},
+		{"example.com/repo.hg/pkg", "hg"},
+		{"example.com/repo.git", "git"},
+		{"code.google.com/p/go.net", ""},
+		{"example.com/repo", ""},
+	} {
+		if vcs := guessVCS(c.name); vcs != c.expected {
+			t.Fatalf("Expected %v, but %v:", c.expected, vcs)
+		}
+	}
+}
+
+func TestRequireTools(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldLookPath := lookPath
+	defer func() { lookPath = oldLookPath }()
+	lookPath = func(file string) (string, error) {
+		if file == "go" {
+			return "/usr/bin/go", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	goms := []Gom{
+		{name: "github.com/mattn/gom", options: map[string]interface{}{}},
+		{name: "launchpad.net/goyaml", options: map[string]interface{}{"tag": "v1"}},
+		{name: "example.com/private", options: map[string]interface{}{"private": "true"}},
+		{name: "example.com/local", options: map[string]interface{}{"path": "../local"}},
+		{name: "example.com/repo", options: map[string]interface{}{}},
+	}
+	err = requireTools(goms, dir)
+	var me *MissingToolError
+	if !errors.As(err, &me) {
+		t.Fatalf("Expected a MissingToolError, but %v:", err)
+	}
+	expected := map[string][]string{
+		"git": {"github.com/mattn/gom", "example.com/private"},
+		"bzr": {"launchpad.net/goyaml"},
+	}
+	if !reflect.DeepEqual(me.Needed, expected) {
+		t.Fatalf("Expected %v, but %v:", expected, me.Needed)
+	}
+	message := "bzr isn't installed, but needed by launchpad.net/goyaml; git isn't installed, but needed by github.com/mattn/gom, example.com/private"
+	if err.Error() != message {
+		t.Fatalf("Expected %v, but %v:", message, err)
+	}
+
+	if err = requireTools(goms[3:], dir); err != nil {
+		t.Fatalf("Expected no error, but %v:", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// update fetches the latest revisions of the named goms, or of every gom if
+// none are named, and re-applies their branch/tag/commit constraints. Their
+// submodules, patches and post_checkout commands follow as for install.
+func update(names []string) error {
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	vendorGopath = vendor
+
+	goms, err := selectGoms(filterGoms(allGoms), names)
+	if err != nil {
+		return err
+	}
+
+	for _, gom := range goms {
+		if local, ok := gom.localPath(); ok {
+			fmt.Printf("skipping %s (path %s)\n", gom.name, local)
+			continue
+		}
+		if gom.isRelease() {
+			fmt.Printf("skipping %s (release)\n", gom.name)
+			continue
+		}
+		vcs := gom.vcs(vendor)
+		if vcs == nil {
+			return fmt.Errorf("%s is not installed, run gom install first", gom.name)
+		}
+		p := gom.dir(vendor)
+		before, _ := vcs.Revision(p)
+
+		progressf("updating %s\n", gom.name)
+		err = vcs.Update(p)
+		if err != nil {
+			return err
+		}
+		err = gom.Checkout()
+		if err != nil {
+			return err
+		}
+		// The checkout of an hg branch is already its latest head, and of a
+		// bookmark somewhere hg update would leave.
+		if !has(gom.options, "tag") && !has(gom.options, "commit") && !has(gom.options, "ref") && !(vcs == hg && has(gom.options, "branch")) {
+			err = vcs.FastForward(p)
+			if err != nil {
+				return err
+			}
+		}
+		// Checkout reverted the patch, which goes back on the new revision.
+		err = gom.finishCheckout()
+		if err != nil {
+			return err
+		}
+
+		after, _ := vcs.Revision(p)
+		if before != after {
+			fmt.Printf("%s changed %s -> %s\n", gom.name, before, after)
+		}
+	}
+
+	if isFile(lockfilePath()) {
+		return genLockfile()
+	}
+	return nil
+}
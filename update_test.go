@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdatePatches(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no touch command")
+	}
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor, oldVendorGopath, oldGomfile := vendorFolder, vendorGopath, *gomfileFlag
+	defer func() { vendorFolder, vendorGopath, *gomfileFlag = oldVendor, oldVendorGopath, oldGomfile }()
+	vendorFolder = filepath.Join(dir, "_vendor")
+	vendorGopath = ""
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+
+	origin := filepath.Join(dir, "origin")
+	initGitRepo(t, origin, "https://example.com/repo.git")
+	root := filepath.Join(vendorFolder, "src", "example.com", "repo")
+	cmd := exec.Command("git", "clone", "-q", origin, root)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v: %s", err, out)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "new.diff"), []byte(`diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++package repo
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(*gomfileFlag, []byte("gom 'example.com/repo', :patch => 'new.diff', :post_checkout => 'touch hooked'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The patch and the post_checkout command follow the update as they
+	// follow an install.
+	err = update(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"new.go", "hooked"} {
+		if !isFile(filepath.Join(root, name)) {
+			t.Fatalf("Expected %v after the update", filepath.Join(root, name))
+		}
+	}
+	if vendorGopath != vendorFolder {
+		t.Fatalf("Expected %v, but %v:", vendorFolder, vendorGopath)
+	}
+}
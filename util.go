@@ -1,10 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 )
@@ -12,13 +12,6 @@ import (
 // Use a wrapper to differentiate logged panics from unexpected ones.
 type LoggedError struct{ error }
 
-func panicOnError(err error, msg string) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Abort: %s: %s\n", msg, err)
-		panic(err)
-	}
-}
-
 func errorf(format string, args ...interface{}) {
 	// Ensure the user's command prompt starts on the next line.
 	if !strings.HasSuffix(format, "\n") {
@@ -28,63 +21,129 @@ func errorf(format string, args ...interface{}) {
 	panic(LoggedError{}) // Panic instead of os.Exit so that deferred will run.
 }
 
-func mustCopyFile(destFilename, srcFilename string) {
-	destFile, err := os.Create(destFilename)
-	panicOnError(err, "Failed to create file "+destFilename)
-
-	srcFile, err := os.Open(srcFilename)
-	panicOnError(err, "Failed to open file "+srcFilename)
-
-	_, err = io.Copy(destFile, srcFile)
-	panicOnError(err,
-		fmt.Sprintf("Failed to copy data from %s to %s", srcFile.Name(), destFile.Name()))
+// copyDir copies the directory tree srcDir, or the one it links to, over to
+// destDir. Version control metadata is copied too, so the copy is a checkout
+// of its own. Symbolic links are copied as links, not what they point to,
+// and files and directories keep their modes.
+func copyDir(destDir, srcDir string) error {
+	fullSrcDir, err := filepath.EvalSymlinks(srcDir)
+	if err != nil {
+		return err
+	}
 
-	err = destFile.Close()
-	panicOnError(err, "Failed to close file "+destFile.Name())
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+	err = filepath.Walk(fullSrcDir, func(srcPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Get the relative path from the source base, and the corresponding path in
+		// the dest directory.
+		relSrcPath, err := filepath.Rel(fullSrcDir, srcPath)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(destDir, relSrcPath)
 
-	err = srcFile.Close()
-	panicOnError(err, "Failed to close file "+srcFile.Name())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return os.Symlink(target, destPath)
+		case info.IsDir():
+			// Keep it writable until its files are copied into it.
+			err := os.MkdirAll(destPath, info.Mode().Perm()|0700)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{destPath, info.Mode().Perm()})
+			return os.Chmod(destPath, info.Mode().Perm()|0700)
+		case info.Mode().IsRegular():
+			return copyFile(destPath, srcPath, info.Mode().Perm())
+		}
+		// Sockets, devices and pipes aren't part of a checkout.
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Subdirectories first, while their parents can still be entered.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = os.Chmod(dirs[i].path, dirs[i].mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func mustChmod(filename string, mode os.FileMode) {
-	err := os.Chmod(filename, mode)
-	panicOnError(err, fmt.Sprintf("Failed to chmod %d %q", mode, filename))
+// copyFile copies the file srcFilename to destFilename, with mode.
+func copyFile(destFilename, srcFilename string, mode os.FileMode) error {
+	srcFile, err := os.Open(srcFilename)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	// A read-only file, like a git object, can't be opened to write over.
+	if err := os.Remove(destFilename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	destFile, err := os.OpenFile(destFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destFile, srcFile)
+	if cerr := destFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// The umask may have taken bits off the mode.
+	return os.Chmod(destFilename, mode)
 }
 
-// copyDir copies a directory tree over to a new directory.
-// Also, dot files and dot directories are skipped.
-func mustCopyDir(destDir, srcDir string) error {
-	var fullSrcDir string
-	// Handle symlinked directories.
-	f, err := os.Lstat(srcDir)
-	if err == nil && f.Mode()&os.ModeSymlink == os.ModeSymlink {
-		fullSrcDir, err = os.Readlink(srcDir)
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		fullSrcDir = srcDir
+// readRecords reads a file of whitespace separated records of min to max
+// fields each, one per line. Blank lines and lines starting with # are skipped.
+func readRecords(filename string, min, max int) ([][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	br := bufio.NewReader(f)
 
-	return filepath.Walk(fullSrcDir, func(srcPath string, info os.FileInfo, err error) error {
-		// Get the relative path from the source base, and the corresponding path in
-		// the dest directory.
-		relSrcPath := strings.TrimLeft(srcPath[len(fullSrcDir):], string(os.PathSeparator))
-		destPath := path.Join(destDir, relSrcPath)
+	records := make([][]string, 0)
 
-		// Create a subdirectory if necessary.
-		if info.IsDir() {
-			err := os.MkdirAll(path.Join(destDir, relSrcPath), 0777)
-			if !os.IsExist(err) {
-				panicOnError(err, "Failed to create directory")
+	line := 0
+	for {
+		line++
+		lb, _, err := br.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return records, nil
 			}
-			return nil
+			return nil, err
 		}
-
-		// Else, just copy it over.
-		mustCopyFile(destPath, srcPath)
-		return nil
-	})
+		s := strings.TrimSpace(string(lb))
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		fields := strings.Fields(s)
+		if len(fields) < min || len(fields) > max {
+			return nil, fmt.Errorf("Syntax Error at line %d of %s", line, filename)
+		}
+		records = append(records, fields)
+	}
 }
 
 func exists(filename string) bool {
@@ -103,3 +162,19 @@ func empty(dirname string) bool {
 	results, _ := dir.Readdir(1)
 	return len(results) == 0
 }
+
+// dirSize returns the disk space the files below dir take, counting the
+// size of symbolic links rather than of what they point to.
+func dirSize(dir string) (int64, error) {
+	var n int64
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			n += info.Size()
+		}
+		return nil
+	})
+	return n, err
+}
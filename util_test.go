@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCopyDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges")
+	}
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	for name, mode := range map[string]os.FileMode{
+		".git/objects/ab/cdef": 0444,
+		"tool/build.sh":        0755,
+		"tool/tool.go":         0644,
+		"docs/README":          0444,
+	} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(name), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = os.Chmod(filepath.Join(src, "docs"), 0555)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("tool/build.sh", filepath.Join(src, "build.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("tool", filepath.Join(src, "cmd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst")
+	defer os.Chmod(filepath.Join(dst, "docs"), 0755)
+	defer os.Chmod(filepath.Join(src, "docs"), 0755)
+	// Copying twice writes over the read-only files of the first copy.
+	for i := 0; i < 2; i++ {
+		err = copyDir(dst, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, mode := range map[string]os.FileMode{
+		".git/objects/ab/cdef": 0444,
+		"tool/build.sh":        0755,
+		"tool/tool.go":         0644,
+		"docs/README":          0444,
+		"docs":                 os.ModeDir | 0555,
+	} {
+		fi, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != mode {
+			t.Fatalf("Expected %v for %s, but %v:", mode, name, fi.Mode())
+		}
+	}
+	for name, expected := range map[string]string{"build.sh": "tool/build.sh", "cmd": "tool"} {
+		target, err := os.Readlink(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target != expected {
+			t.Fatalf("Expected %v, but %v:", expected, target)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// installKey returns the key the vendor directory installing goms, as
+// resolveGoms selects them, is archived under: the SHA-256 of Gomfile.lock,
+// of the name, options and patch of each gom, of the active groups and of
+// the flags they are built with, args and -tags. So an install of other
+// groups, or with other options in the Gomfile, gets an archive of its own.
+func installKey(goms []Gom, args []string) (string, error) {
+	body, err := ioutil.ReadFile(lockfilePath())
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(body)
+	fmt.Fprintf(h, "\x00groups %s\x00tags %s\x00args %q\x00", strings.Join(activeGroups(), ","), *buildTags, args)
+	for _, gom := range goms {
+		keys := make([]string, 0, len(gom.options))
+		for key := range gom.options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(h, "gom %s\x00", gom.name)
+		for _, key := range keys {
+			fmt.Fprintf(h, "%s %s\x00", key, formatOption(gom.options[key]))
+		}
+		// The patch may change while the option doesn't.
+		patch, ok, err := gom.patchFile()
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			body, err := ioutil.ReadFile(patch)
+			if err != nil {
+				return "", err
+			}
+			h.Write(body)
+			fmt.Fprint(h, "\x00")
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// vendorArchive returns the archive of the vendor directory of key in dir.
+// The bundles are built for the platform, which is part of the name.
+func vendorArchive(dir, key string) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s_%s.tar.gz", key, runtime.GOOS, runtime.GOARCH))
+}
+
+// useVendorCache returns the archive of the vendor directory installing
+// goms with args, whether it exists yet or not, or "" if install shouldn't go
+// through -vendor-cache: without a lock file to key it, or when installing
+// only some bundles or fetching everything again.
+func useVendorCache(goms []Gom, names []string, args []string) string {
+	if *vendorCache == "" || *dryRun || *noLock || *force || len(names) > 0 || !isFile(lockfilePath()) {
+		return ""
+	}
+	key, err := installKey(goms, args)
+	if err != nil {
+		warnf("can't key the vendor cache: %v\n", err)
+		return ""
+	}
+	return vendorArchive(*vendorCache, key)
+}
+
+// archiveDir writes the tree below dir to archive as a gzipped tar, keeping
+// symbolic links as links. The archive is written next to where it goes and
+// renamed there, so a reader never sees half of it.
+func archiveDir(archive, dir string) (err error) {
+	err = os.MkdirAll(filepath.Dir(archive), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(archive), "."+filepath.Base(archive)+".new")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), archive)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			// Sockets, devices and pipes aren't part of a checkout.
+			return nil
+		}
+		h, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		h.Name = filepath.ToSlash(rel)
+		err = tw.WriteHeader(h)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		r, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// restoreDir extracts the archive archiveDir wrote into dir, over what is
+// already there. install extracts it into an empty directory with
+// restoreVendor.
+func restoreDir(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, err := archivePath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			// Keep it writable until its files are extracted into it.
+			err = os.MkdirAll(p, os.FileMode(h.Mode).Perm()|0700)
+		case tar.TypeReg:
+			// A read-only file, like a git object, can't be opened to write over.
+			if err = os.Remove(p); err == nil || os.IsNotExist(err) {
+				err = writeArchiveFile(p, tr, os.FileMode(h.Mode).Perm())
+			}
+		case tar.TypeSymlink:
+			if err = os.Remove(p); err == nil || os.IsNotExist(err) {
+				err = os.Symlink(h.Linkname, p)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// restoreVendor replaces the vendor directory with the tree of archive. The
+// archive is extracted next to it and swapped into place once complete, so
+// nothing of the earlier tree survives and a failed restore leaves it as
+// it was.
+func restoreVendor(archive, vendor string) error {
+	parent := filepath.Dir(vendor)
+	err := os.MkdirAll(parent, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(parent, "."+filepath.Base(vendor)+".restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	err = restoreDir(archive, tmp)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp, 0755)
+	if err != nil {
+		return err
+	}
+	old := tmp + ".old"
+	if err = os.Rename(vendor, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = os.Rename(tmp, vendor); err != nil {
+		os.Rename(old, vendor)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// cacheKey prints the key -vendor-cache archives the vendor directory under
+// when installing with the same flags and args, for CI caches keyed by a
+// command's output.
+func cacheKey(args []string) error {
+	args = goArgs(args)
+	allGoms, err := parseGomfile(gomfilePath())
+	if err != nil {
+		return err
+	}
+	goms, _, err := resolveGoms(allGoms, nil)
+	if err != nil {
+		return err
+	}
+	key, err := installKey(goms, args)
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVendorCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "vendor", "src", "github.com", "mattn", "gom")
+	err = os.MkdirAll(filepath.Join(src, ".git", "objects"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, "gom.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(src, ".git", "objects", "ab"), []byte("object"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("gom.go", filepath.Join(src, "link.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := vendorArchive(filepath.Join(dir, "cache"), "key")
+	err = archiveDir(archive, filepath.Join(dir, "vendor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring over an earlier install replaces its read-only files too.
+	restored := filepath.Join(dir, "restored")
+	dst := filepath.Join(restored, "src", "github.com", "mattn", "gom")
+	err = os.MkdirAll(filepath.Join(dst, ".git", "objects"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dst, ".git", "objects", "ab"), []byte("old"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = restoreDir(archive, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"gom.go": "package main\n", ".git/objects/ab": "object", "link.go": "package main\n"} {
+		b, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("Expected %v, but %v:", expected, string(b))
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link.go")); err != nil || target != "gom.go" {
+		t.Fatalf("Expected %v, but %v:", "gom.go", target)
+	}
+}
+
+func TestInstallFromVendorCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor, oldGomfile, oldCache := vendorFolder, *gomfileFlag, *vendorCache
+	defer func() { vendorFolder, *gomfileFlag, *vendorCache = oldVendor, oldGomfile, oldCache }()
+	vendorFolder = filepath.Join(dir, "_vendor")
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	*vendorCache = filepath.Join(dir, "cache")
+
+	err = ioutil.WriteFile(*gomfileFlag, []byte("gom 'github.com/mattn/gom'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(lockfilePath(), []byte("github.com/mattn/gom git 8897bf14\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive := useVendorCache(nil, []string{"github.com/mattn/gom"}, nil); archive != "" {
+		t.Fatalf("Expected %v, but %v:", "", archive)
+	}
+
+	tree := filepath.Join(dir, "tree")
+	err = os.MkdirAll(filepath.Join(tree, "src", "github.com", "mattn", "gom"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tree, "src", "github.com", "mattn", "gom", "gom.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allGoms, err := parseGomfile(*gomfileFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goms, _, err := resolveGoms(allGoms, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := installKey(goms, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = archiveDir(vendorArchive(*vendorCache, key), tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What an earlier install left doesn't survive the restore.
+	stale := filepath.Join(vendorFolder, "src", "github.com", "mattn", "gom", "removed.go")
+	err = os.MkdirAll(filepath.Dir(stale), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(stale, []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is fetched, the archive of the same Gomfile.lock is extracted.
+	err = install(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFile(filepath.Join(vendorFolder, "src", "github.com", "mattn", "gom", "gom.go")) {
+		t.Fatal("Expected gom.go to be restored from the vendor cache")
+	}
+	if isFile(stale) {
+		t.Fatalf("Expected %v to be removed by the restore", stale)
+	}
+	sums, err := parseSumfile(sumfilePath())
+	if err != nil || len(sums) != 1 {
+		t.Fatalf("Expected %v, but %v:", 1, []interface{}{sums, err})
+	}
+
+	// An archive that doesn't match Gomfile.sum is refused.
+	err = ioutil.WriteFile(sumfilePath(), []byte("github.com/mattn/gom - "+strings.Repeat("0", 64)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = install(nil)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch, but %v:", err)
+	}
+}
+
+func TestInstallKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldGomfile, oldProduction, oldTest, oldTags := *gomfileFlag, *productionEnv, *testEnv, *buildTags
+	defer func() {
+		*gomfileFlag, *productionEnv, *testEnv, *buildTags = oldGomfile, oldProduction, oldTest, oldTags
+	}()
+	*gomfileFlag = filepath.Join(dir, "Gomfile")
+	err = ioutil.WriteFile(*gomfileFlag, []byte(`gom 'github.com/mattn/gom'
+gom 'github.com/golang/mock', :group => 'test'
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(lockfilePath(), []byte("github.com/mattn/gom git 8897bf14\ngithub.com/golang/mock git 703b5e6b\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(args ...string) string {
+		allGoms, err := parseGomfile(*gomfileFlag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goms, _, err := resolveGoms(allGoms, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := installKey(goms, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	*testEnv = true
+	test := key()
+	if again := key(); again != test {
+		t.Fatalf("Expected %v, but %v:", test, again)
+	}
+	*testEnv, *productionEnv = false, true
+	keys := map[string]string{"test": test, "production": key()}
+	*buildTags = "netgo"
+	keys["tags"] = key()
+	*buildTags = ""
+	keys["args"] = key("-race")
+	err = ioutil.WriteFile(*gomfileFlag, []byte("gom 'github.com/mattn/gom', :post_checkout => 'go generate'\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys["post_checkout"] = key()
+
+	// The same Gomfile.lock, but each installs something else.
+	seen := make(map[string]string)
+	for name, k := range keys {
+		if other, ok := seen[k]; ok {
+			t.Fatalf("Expected %v and %v to have different keys", name, other)
+		}
+		seen[k] = name
+	}
+}
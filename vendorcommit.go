@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// manifestFile records, in the vendor directory, the revision each vendored
+// repository was at when vendor-commit removed its version control
+// directory, in the format of Gomfile.lock.
+const manifestFile = "gom.manifest"
+
+// stripVCS removes the version control directories and files below dir,
+// or with onlyPrint prints them, and returns how many there were.
+func stripVCS(dir string, onlyPrint bool) (int, error) {
+	n := 0
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !isVCSMetadata(info.Name()) {
+			return nil
+		}
+		n++
+		if onlyPrint {
+			fmt.Printf("would remove %s\n", p)
+		} else {
+			tracef("+ rm -r %s\n", p)
+			err = os.RemoveAll(p)
+			if err != nil {
+				return err
+			}
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return n, err
+}
+
+// mergeManifest returns the entries of locks, and those of the repositories
+// an earlier vendor-commit recorded in old that are still in src.
+func mergeManifest(old, locks []lock, src string) []lock {
+	seen := make(map[string]bool)
+	for _, l := range locks {
+		seen[l.name] = true
+	}
+	for _, l := range old {
+		if !seen[l.name] && isDir(filepath.Join(src, filepath.FromSlash(l.name))) {
+			locks = append(locks, l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].name < locks[j].name })
+	return locks
+}
+
+func writeManifest(filename string, locks []lock) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# Generated by gom vendor-commit. Do not edit.")
+	for _, l := range locks {
+		fmt.Fprintf(w, "%s %s %s\n", l.name, l.vcs, l.revision)
+	}
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// vendorCommit readies the vendor directory to be committed: it records
+// the revision of each vendored repository into the manifest, then removes
+// their version control directories. None is touched if any has local
+// changes, which the revision wouldn't account for.
+func vendorCommit(args []string) error {
+	fs := flag.NewFlagSet("vendor-commit", flag.ExitOnError)
+	onlyPrint := fs.Bool("dry-run", *dryRun, "only print what would be recorded and removed")
+	fs.Parse(args)
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	repos, err := vendoredRepos(vendor)
+	if err != nil {
+		return err
+	}
+	src := filepath.Join(vendor, "src")
+	locks := make([]lock, 0)
+	dirty := 0
+	for _, repo := range repos {
+		p := filepath.Join(src, filepath.FromSlash(repo))
+		vcs := detectVCS(p)
+		changes, err := vcs.Changes(p)
+		if err != nil {
+			return fmt.Errorf("can't tell the status of %s: %v", repo, err)
+		}
+		if len(changes) > 0 {
+			fmt.Fprintf(os.Stderr, "%s has local changes\n", repo)
+			dirty++
+			continue
+		}
+		revision, err := vcs.Revision(p)
+		if err != nil {
+			return err
+		}
+		locks = append(locks, lock{repo, vcs.name, revision, ""})
+	}
+	if dirty > 0 {
+		return fmt.Errorf("%d vendored repositories have local changes, see gom status", dirty)
+	}
+
+	manifest := filepath.Join(vendor, manifestFile)
+	if *onlyPrint {
+		for _, l := range locks {
+			fmt.Printf("would record %s at %s\n", l.name, l.revision)
+		}
+	} else if len(locks) > 0 {
+		old := make([]lock, 0)
+		if isFile(manifest) {
+			old, err = parseLockfile(manifest)
+			if err != nil {
+				return err
+			}
+		}
+		err = writeManifest(manifest, mergeManifest(old, locks, src))
+		if err != nil {
+			return err
+		}
+	}
+	for _, l := range locks {
+		n, err := stripVCS(filepath.Join(src, filepath.FromSlash(l.name)), *onlyPrint)
+		if err != nil {
+			return err
+		}
+		if n > 0 && !*onlyPrint {
+			progressf("stripped %s at %s\n", l.name, l.revision)
+		}
+	}
+	return nil
+}
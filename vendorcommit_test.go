@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVendorCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldVendor := vendorFolder
+	defer func() { vendorFolder = oldVendor }()
+	vendorFolder = dir
+
+	repo := filepath.Join(dir, "src", "github.com", "mattn", "gom")
+	_, second := initGitRepo(t, repo, "https://github.com/mattn/gom.git")
+	other := filepath.Join(dir, "src", "github.com", "mattn", "go-runewidth")
+	initGitRepo(t, other, "https://github.com/mattn/go-runewidth.git")
+	err = ioutil.WriteFile(filepath.Join(other, "patch.go"), []byte("package runewidth\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A repository with local changes stops them all from being stripped.
+	err = vendorCommit(nil)
+	if err == nil {
+		t.Fatal("Expected an error for the local changes of go-runewidth")
+	}
+	if !isDir(filepath.Join(repo, ".git")) {
+		t.Fatalf("Expected %v to be kept", filepath.Join(repo, ".git"))
+	}
+
+	err = os.Remove(filepath.Join(other, "patch.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vendorCommit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{repo, other} {
+		if isDir(filepath.Join(p, ".git")) {
+			t.Fatalf("Expected %v to be removed", filepath.Join(p, ".git"))
+		}
+		if !isDir(p) {
+			t.Fatalf("Expected %v to be kept", p)
+		}
+	}
+	locks, err := parseLockfile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 2 || !reflect.DeepEqual(locks[1], lock{"github.com/mattn/gom", "git", second, ""}) {
+		t.Fatalf("Expected %v, but %v:", lock{"github.com/mattn/gom", "git", second, ""}, locks)
+	}
+
+	// Running it again keeps what the manifest recorded.
+	err = vendorCommit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := parseLockfile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, locks) {
+		t.Fatalf("Expected %v, but %v:", locks, again)
+	}
+}
+
+func TestWriteManifestError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	// The write only fails once what was written is flushed.
+	err := writeManifest("/dev/full", []lock{{name: "github.com/mattn/go-runewidth", vcs: "git", revision: "14e809f6d3f5"}})
+	if err == nil {
+		t.Fatalf("Expected the full device to fail the write, but nil:")
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var re_version = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// version is a semantic version parsed from a tag. Missing minor and patch
+// numbers are zero.
+type version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func parseVersion(s string) (version, bool) {
+	m := re_version.FindStringSubmatch(s)
+	if m == nil {
+		return version{}, false
+	}
+	var v version
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	v.patch, _ = strconv.Atoi(m[3])
+	v.pre = m[4]
+	return v, true
+}
+
+// compare returns -1, 0 or 1 when v is lower than, equal to or higher than w.
+// A pre-release is lower than the release it precedes, and pre-releases are
+// ordered by comparePre.
+func (v version) compare(w version) int {
+	for _, d := range []int{v.major - w.major, v.minor - w.minor, v.patch - w.patch} {
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.pre == w.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case w.pre == "":
+		return -1
+	}
+	return comparePre(v.pre, w.pre)
+}
+
+// comparePre compares the pre-releases a and b as semantic versioning does,
+// by their dot separated identifiers in turn, the one with more being higher
+// when the others are equal: alpha < alpha.1 < alpha.2 < alpha.10 < beta.
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareIdentifier(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+// compareIdentifier compares two identifiers of a pre-release. Numeric ones
+// compare as numbers and are lower than the others, which compare in ASCII
+// order but for their runs of digits, compared as numbers too, so rc2 is
+// lower than rc10 as the tags mean.
+func compareIdentifier(a, b string) int {
+	an, bn := digitPrefix(a) == len(a), digitPrefix(b) == len(b)
+	switch {
+	case an && bn:
+		return compareDigits(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	for a != "" && b != "" {
+		if ad, bd := digitPrefix(a), digitPrefix(b); ad > 0 && bd > 0 {
+			if c := compareDigits(a[:ad], b[:bd]); c != 0 {
+				return c
+			}
+			a, b = a[ad:], b[bd:]
+			continue
+		}
+		if a[0] != b[0] {
+			return compareInts(int(a[0]), int(b[0]))
+		}
+		a, b = a[1:], b[1:]
+	}
+	return compareInts(len(a), len(b))
+}
+
+// digitPrefix returns the number of digits s starts with.
+func digitPrefix(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// compareDigits compares the decimal numbers a and b, of any length.
+func compareDigits(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return compareInts(len(a), len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+type comparator struct {
+	op string
+	v  version
+}
+
+func (c comparator) match(v version) bool {
+	n := v.compare(c.v)
+	switch c.op {
+	case ">=":
+		return n >= 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	case "<":
+		return n < 0
+	case "!=":
+		return n != 0
+	}
+	return n == 0
+}
+
+var constraintOps = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+// isVersionConstraint returns true if tag is a constraint such as
+// ">=1.2.0 <2.0.0" rather than the name of a tag.
+func isVersionConstraint(tag string) bool {
+	for _, op := range constraintOps {
+		if strings.HasPrefix(tag, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseConstraint parses space separated comparators, all of which must
+// match. Above the usual comparison operators, ~1.2.3 means >=1.2.3 <1.3.0
+// and ^1.2.3 means >=1.2.3 <2.0.0, or <0.3.0 below 1.0.0.
+func parseConstraint(constraint string) ([]comparator, error) {
+	fields := strings.Fields(constraint)
+	comparators := make([]comparator, 0)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		op := ""
+		for _, o := range constraintOps {
+			if strings.HasPrefix(field, o) {
+				op = o
+				break
+			}
+		}
+		s := field[len(op):]
+		if s == "" && i+1 < len(fields) {
+			// The operator is separated from its version: ">= 1.2.0"
+			i++
+			s = fields[i]
+		}
+		v, ok := parseVersion(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid version constraint %q", constraint)
+		}
+		switch op {
+		case "~":
+			comparators = append(comparators,
+				comparator{">=", v},
+				comparator{"<", version{v.major, v.minor + 1, 0, ""}})
+		case "^":
+			upper := version{v.major + 1, 0, 0, ""}
+			if v.major == 0 {
+				upper = version{0, v.minor + 1, 0, ""}
+			}
+			comparators = append(comparators, comparator{">=", v}, comparator{"<", upper})
+		default:
+			comparators = append(comparators, comparator{op, v})
+		}
+	}
+	if len(comparators) == 0 {
+		return nil, fmt.Errorf("invalid version constraint %q", constraint)
+	}
+	return comparators, nil
+}
+
+// highestTag returns the tag with the highest version satisfying
+// constraint. Pre-releases are only considered when the constraint names
+// one.
+func highestTag(tags []string, constraint string) (string, error) {
+	comparators, err := parseConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	allowPre := false
+	for _, c := range comparators {
+		if c.v.pre != "" {
+			allowPre = true
+		}
+	}
+
+	best := ""
+	var bestVersion version
+	for _, tag := range tags {
+		v, ok := parseVersion(tag)
+		if !ok || (v.pre != "" && !allowPre) {
+			continue
+		}
+		matched := true
+		for _, c := range comparators {
+			if !c.match(v) {
+				matched = false
+				break
+			}
+		}
+		if matched && (best == "" || v.compare(bestVersion) > 0) {
+			best, bestVersion = tag, v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no tag satisfies %q", constraint)
+	}
+	return best, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHighestTag(t *testing.T) {
+	tags := []string{"v1.0.0", "v1.2.0", "v1.2.5", "v1.3.0-rc1", "v1.10.0", "v2.0.0", "go1", "release"}
+	for _, c := range []struct {
+		constraint, expected string
+	}{
+		{">=1.2.0 <2.0.0", "v1.10.0"},
+		{">= 1.2.0 < 1.3.0", "v1.2.5"},
+		{">=1.2.0,<1.3.0", ""},
+		{"~1.2.0", "v1.2.5"},
+		{"^1.2", "v1.10.0"},
+		{">1.2.0 <1.3.0", "v1.2.5"},
+		{">=1.3.0-rc1 <1.4.0", "v1.3.0-rc1"},
+		{"<1.0.0", ""},
+		{">=1", "v2.0.0"},
+		{"!=v2.0.0", "v1.10.0"},
+	} {
+		tag, err := highestTag(tags, c.constraint)
+		if c.expected == "" {
+			if err == nil {
+				t.Fatalf("Expected an error for %q, but %v:", c.constraint, tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag != c.expected {
+			t.Fatalf("Expected %v for %q, but %v:", c.expected, c.constraint, tag)
+		}
+	}
+}
+
+func TestIsVersionConstraint(t *testing.T) {
+	for _, tag := range []string{">=1.2.0 <2.0.0", "~1.2", "^1.0.0", "<3"} {
+		if !isVersionConstraint(tag) {
+			t.Fatalf("Expected %q to be a constraint", tag)
+		}
+	}
+	for _, tag := range []string{"v1.2.0", "go1", "release-1.0"} {
+		if isVersionConstraint(tag) {
+			t.Fatalf("Expected %q to be a tag", tag)
+		}
+	}
+}
+
+func TestComparePre(t *testing.T) {
+	// Each lower than the next.
+	versions := []string{
+		"1.0.0-1", "1.0.0-2", "1.0.0-10", "1.0.0-alpha", "1.0.0-alpha.1",
+		"1.0.0-alpha.2", "1.0.0-alpha.10", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-rc1", "1.0.0-rc2", "1.0.0-rc10", "1.0.0",
+	}
+	for i := 0; i+1 < len(versions); i++ {
+		v, _ := parseVersion(versions[i])
+		w, _ := parseVersion(versions[i+1])
+		if c := v.compare(w); c != -1 {
+			t.Fatalf("Expected %v < %v, but %v:", versions[i], versions[i+1], c)
+		}
+		if c := w.compare(v); c != 1 {
+			t.Fatalf("Expected %v > %v, but %v:", versions[i+1], versions[i], c)
+		}
+	}
+	v, _ := parseVersion("1.0.0-rc.01")
+	w, _ := parseVersion("1.0.0-rc.1")
+	if c := v.compare(w); c != 0 {
+		t.Fatalf("Expected %v, but %v:", 0, c)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// importChain returns the shortest chain of imports from a package of goms
+// vendored in vendor to the package path, or to a package below it, or nil
+// if nothing there imports it.
+func importChain(vendor string, goms []Gom, path string) ([]string, error) {
+	src := filepath.Join(vendor, "src")
+	queue, err := gomPackages(src, goms)
+	if err != nil {
+		return nil, err
+	}
+	parent := make(map[string]string)
+	visited := make(map[string]bool)
+	for _, pkg := range queue {
+		visited[pkg] = true
+	}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if pkg == path || strings.HasPrefix(pkg, path+"/") {
+			chain := []string{pkg}
+			for p, ok := parent[pkg]; ok; p, ok = parent[p] {
+				chain = append([]string{p}, chain...)
+			}
+			return chain, nil
+		}
+		imports, err := packageImports(filepath.Join(src, filepath.FromSlash(pkg)))
+		if err != nil {
+			// Not vendored, e.g. a standard package.
+			continue
+		}
+		for _, imp := range imports {
+			if isStandardImport(imp) || visited[imp] {
+				continue
+			}
+			visited[imp] = true
+			parent[imp] = pkg
+			queue = append(queue, imp)
+		}
+	}
+	return nil, nil
+}
+
+// why prints why the package path is vendored: because it is in the
+// Gomfile, or the chain of imports leading to it from a package that is.
+func why(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: gom why <import path>")
+	}
+	path := strings.TrimSuffix(args[0], "/")
+	goms, err := parseGomfileGroups(gomfilePath(), anyGroup)
+	if err != nil {
+		return err
+	}
+	for _, gom := range goms {
+		for _, name := range []string{gom.name, getTarget(&gom)} {
+			if name == path {
+				fmt.Printf("%s is in %s\n", path, gomfilePath())
+				return nil
+			}
+			if strings.HasPrefix(path, name+"/") {
+				fmt.Printf("%s is part of %s, which is in %s\n", path, name, gomfilePath())
+				return nil
+			}
+		}
+	}
+
+	vendor, err := filepath.Abs(vendorFolder)
+	if err != nil {
+		return err
+	}
+	chain, err := importChain(vendor, goms, path)
+	if err != nil {
+		return err
+	}
+	if chain == nil {
+		return fmt.Errorf("nothing in %s imports %s", gomfilePath(), path)
+	}
+	fmt.Printf("# %s\n", path)
+	for _, pkg := range chain {
+		fmt.Println(pkg)
+	}
+	return nil
+}
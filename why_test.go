@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"src/github.com/mattn/go-gtk/gtk/gtk.go": `package gtk
+
+import (
+	"fmt"
+
+	"github.com/mattn/go-gtk/glib"
+)
+`,
+		"src/github.com/mattn/go-gtk/glib/glib.go": `package glib
+
+import "github.com/mattn/go-pointer"
+`,
+		"src/github.com/mattn/go-pointer/pointer.go": `package pointer
+
+import "github.com/mattn/go-ole/oleutil"
+`,
+		"src/github.com/mattn/go-ole/oleutil/oleutil.go": "package oleutil\n",
+		"src/github.com/mattn/go-unused/unused.go":       "package unused\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goms := []Gom{{name: "github.com/mattn/go-gtk", options: map[string]interface{}{}}}
+	for _, c := range []struct {
+		path     string
+		expected []string
+	}{
+		{"github.com/mattn/go-pointer", []string{"github.com/mattn/go-gtk/glib", "github.com/mattn/go-pointer"}},
+		{"github.com/mattn/go-ole", []string{"github.com/mattn/go-gtk/glib", "github.com/mattn/go-pointer", "github.com/mattn/go-ole/oleutil"}},
+		{"github.com/mattn/go-unused", nil},
+	} {
+		chain, err := importChain(dir, goms, c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(chain, c.expected) {
+			t.Fatalf("Expected %v, but %v:", c.expected, chain)
+		}
+	}
+}